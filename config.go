@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// configFileName is the optional project config, looked up next to the source file
+const configFileName = "ay.json"
+
+// projectConfig holds project-wide settings from ay.json
+type projectConfig struct {
+	// KeywordPack is a path to a keyword pack, relative to ay.json
+	KeywordPack string `json:"keywordPack"`
+}
+
+// loadProjectConfig reads ay.json from dir. A missing file gives an empty config.
+func loadProjectConfig(dir string) (projectConfig, error) {
+	var config projectConfig
+
+	path := filepath.Join(dir, configFileName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("invalid %s: %v", path, err)
+	}
+
+	if config.KeywordPack != "" && !filepath.IsAbs(config.KeywordPack) {
+		config.KeywordPack = filepath.Join(dir, config.KeywordPack)
+	}
+	return config, nil
+}
@@ -0,0 +1,151 @@
+// Channel utilities for AY language
+// Tasks started with spawn talk over channels. The compiler awaits send, recv,
+// sleep and select for you, so they read like blocking calls.
+
+class __ayChannel {
+  constructor(size) {
+    this.size = size;
+    this.buffer = [];
+    this.senders = []; // waiting senders: { value, take() }
+    this.receivers = []; // waiting receivers: (value) => taken
+    this.closed = false;
+  }
+
+  // Hands value to a waiting receiver or the buffer. Returns false if the
+  // sender has to wait.
+  trySend(value) {
+    if (this.closed) {
+      console.error("Cannot send on a closed channel");
+      process.exit(1)
+    }
+    while (this.receivers.length > 0) {
+      if (this.receivers.shift()(value)) return true;
+    }
+    if (this.buffer.length < this.size) {
+      this.buffer.push(value);
+      return true;
+    }
+    return false;
+  }
+
+  // Takes a value from the buffer or a waiting sender. A closed, empty
+  // channel gives undefined right away.
+  tryRecv() {
+    if (this.buffer.length > 0) {
+      const value = this.buffer.shift();
+      // Room in the buffer lets a waiting sender finish
+      while (this.senders.length > 0) {
+        const sender = this.senders.shift();
+        if (sender.take()) {
+          this.buffer.push(sender.value);
+          break;
+        }
+      }
+      return { ok: true, value };
+    }
+    while (this.senders.length > 0) {
+      const sender = this.senders.shift();
+      if (sender.take()) return { ok: true, value: sender.value };
+    }
+    if (this.closed) return { ok: true, value: undefined };
+    return { ok: false };
+  }
+}
+
+// Waiters share a state with the other cases of the same select, so only one
+// of them can fire
+function __ayReceiver(state, resolve) {
+  return (value) => {
+    if (state.done) return false;
+    state.done = true;
+    resolve(value);
+    return true;
+  };
+}
+
+function __aySender(state, value, resolve) {
+  return {
+    value,
+    take() {
+      if (state.done) return false;
+      state.done = true;
+      resolve();
+      return true;
+    },
+  };
+}
+
+// New channel. Unbuffered by default: a send waits until a receiver takes it
+function chan(size = 0) {
+  return new __ayChannel(size);
+}
+
+function send(ch, value) {
+  if (ch.trySend(value)) return Promise.resolve();
+  return new Promise((resolve) => {
+    ch.senders.push(__aySender({ done: false }, value, resolve));
+  });
+}
+
+// Next value from ch, or undefined once ch is closed and empty
+function recv(ch) {
+  const got = ch.tryRecv();
+  if (got.ok) return Promise.resolve(got.value);
+  return new Promise((resolve) => {
+    ch.receivers.push(__ayReceiver({ done: false }, resolve));
+  });
+}
+
+// Closes ch. Waiting receivers get undefined; sending afterwards is an error
+function closeChan(ch) {
+  ch.closed = true;
+  while (ch.receivers.length > 0) {
+    ch.receivers.shift()(undefined);
+  }
+  if (ch.senders.some((sender) => sender.take())) {
+    console.error("Cannot send on a closed channel");
+    process.exit(1)
+  }
+}
+
+function sleep(ms) {
+  return new Promise((resolve) => setTimeout(resolve, ms));
+}
+
+// Runs fn(...args) as a separate task. The arguments are evaluated by the
+// caller, so the task sees their values at the time of the spawn
+function __aySpawn(fn, args) {
+  Promise.resolve()
+    .then(() => fn(...args))
+    .catch((error) => {
+      console.error("Error in spawned task:", error);
+      process.exit(1)
+    });
+}
+
+// Waits for the first ready case of a select. cases are [ch, "recv"] or
+// [ch, "send", value]; the result is [case index, received value], with
+// index -1 for the default case
+function __aySelect(cases, hasDefault) {
+  for (let i = 0; i < cases.length; i++) {
+    const [ch, op, value] = cases[i];
+    if (op === "recv") {
+      const got = ch.tryRecv();
+      if (got.ok) return Promise.resolve([i, got.value]);
+    } else if (ch.trySend(value)) {
+      return Promise.resolve([i, undefined]);
+    }
+  }
+  if (hasDefault) return Promise.resolve([-1, undefined]);
+
+  return new Promise((resolve) => {
+    const state = { done: false };
+    cases.forEach(([ch, op, value], i) => {
+      if (op === "recv") {
+        ch.receivers.push(__ayReceiver(state, (got) => resolve([i, got])));
+      } else {
+        ch.senders.push(__aySender(state, value, () => resolve([i, undefined])));
+      }
+    });
+  });
+}
@@ -0,0 +1,25 @@
+// Result utilities for AY language
+// A result is { success: true, value } or { success: false, error }, the same
+// shape the HTTP helpers use for failures
+
+function ok(value) {
+  return { success: true, value: value };
+}
+
+function err(error) {
+  return { success: false, error: error };
+}
+
+function isOk(result) {
+  return result !== null && typeof result === "object" && result.success === true;
+}
+
+function isErr(result) {
+  return result !== null && typeof result === "object" && result.success === false;
+}
+
+// Value of an ok result, or fallback for an err result
+function unwrapOr(result, fallback) {
+  if (isErr(result)) return fallback;
+  return isOk(result) && "value" in result ? result.value : result;
+}
@@ -0,0 +1,171 @@
+// Runtime helpers for AY language
+// The compiler emits calls to these; they are not meant to be called directly
+
+// Reads seq[i], counting negative indices from the end of arrays and strings
+function __ayIndex(seq, i) {
+  if (typeof i === "number" && i < 0 && (Array.isArray(seq) || typeof seq === "string")) {
+    return seq[seq.length + i];
+  }
+  return seq[i];
+}
+
+// Returns the key to assign for seq[i] = value, counting negative indices from the end
+function __ayKey(seq, i) {
+  if (typeof i === "number" && i < 0 && Array.isArray(seq)) {
+    return seq.length + i;
+  }
+  return i;
+}
+
+// Python-style seq[start:end:step] for arrays and strings
+function __aySlice(seq, start, end, step = 1) {
+  if (!Array.isArray(seq) && typeof seq !== "string") {
+    console.error('Slicing needs an array or string but got,', typeof seq, 'instead');
+    process.exit(1)
+  }
+  if (step === 0) {
+    console.error('Slice step cannot be zero');
+    process.exit(1)
+  }
+
+  const n = seq.length;
+  const bound = (i, fallback, lo, hi) => {
+    if (i === undefined || i === null) return fallback;
+    if (i < 0) i += n;
+    return Math.min(Math.max(i, lo), hi);
+  };
+
+  if (step > 0) {
+    start = bound(start, 0, 0, n);
+    end = bound(end, n, 0, n);
+    if (step === 1) return seq.slice(start, Math.max(start, end));
+  } else {
+    start = bound(start, n - 1, -1, n - 1);
+    end = bound(end, -1, -1, n - 1);
+  }
+
+  const out = [];
+  for (let i = start; step > 0 ? i < end : i > end; i += step) {
+    out.push(seq[i]);
+  }
+  return typeof seq === "string" ? out.join("") : out;
+}
+
+// Iterable for a comprehension's for clause. Plain objects give their keys,
+// or [key, value] pairs when the clause unpacks more than one name
+function __ayIter(value, unpack) {
+  if (value !== null && value !== undefined && typeof value[Symbol.iterator] === "function") {
+    return value;
+  }
+  if (value !== null && typeof value === "object") {
+    return unpack ? Object.entries(value) : Object.keys(value);
+  }
+  console.error('Cannot iterate over', typeof value);
+  process.exit(1)
+}
+
+// Records are frozen objects made by a constructor from __ayRecord. Their
+// prototype remembers the record's name and fields.
+const __ayRecordInfo = Symbol("ayRecord");
+
+function __ayRecord(name, fields) {
+  const proto = {
+    toString() {
+      return require("util").inspect(this);
+    },
+    [Symbol.for("nodejs.util.inspect.custom")](depth, options, inspect) {
+      const parts = fields.map((field) => field + ": " + inspect(this[field], options));
+      return name + "(" + parts.join(", ") + ")";
+    },
+  };
+  Object.defineProperty(proto, __ayRecordInfo, { value: { name, fields } });
+
+  const make = (...values) => {
+    if (values.length !== fields.length) {
+      console.error(`${name} expects ${fields.length} field(s) but got ${values.length}`);
+      process.exit(1)
+    }
+    const record = Object.create(proto);
+    fields.forEach((field, i) => {
+      record[field] = values[i];
+    });
+    return Object.freeze(record);
+  };
+  return make;
+}
+
+// value with {field: x}: a copy of value with some fields changed
+function __ayWith(value, changes) {
+  const info = value !== null && typeof value === "object" ? value[__ayRecordInfo] : undefined;
+  if (!info) {
+    return Object.assign({}, value, changes);
+  }
+  for (const field of Object.keys(changes)) {
+    if (!info.fields.includes(field)) {
+      console.error(`${info.name} has no field ${field}`);
+      process.exit(1)
+    }
+  }
+  const copy = Object.create(Object.getPrototypeOf(value));
+  for (const field of info.fields) {
+    copy[field] = field in changes ? changes[field] : value[field];
+  }
+  return Object.freeze(copy);
+}
+
+// AY == and !=. Records, arrays and plain objects are equal when their contents
+// are; anything else is compared with ===, or == when loose is set (-loose-eq)
+function __ayEq(a, b, loose = false) {
+  if (a === b) return true;
+
+  const infoA = a !== null && typeof a === "object" ? a[__ayRecordInfo] : undefined;
+  const infoB = b !== null && typeof b === "object" ? b[__ayRecordInfo] : undefined;
+  if (infoA || infoB) {
+    return infoA === infoB && infoA.fields.every((field) => __ayEq(a[field], b[field], loose));
+  }
+  if (loose) return a == b;
+
+  if (Array.isArray(a) || Array.isArray(b)) {
+    return Array.isArray(a) && Array.isArray(b) && a.length === b.length &&
+      a.every((item, i) => __ayEq(item, b[i]));
+  }
+
+  const plain = (v) => v !== null && typeof v === "object" &&
+    [Object.prototype, null].includes(Object.getPrototypeOf(v));
+  if (plain(a) && plain(b)) {
+    const keys = Object.keys(a);
+    return keys.length === Object.keys(b).length &&
+      keys.every((key) => Object.hasOwn(b, key) && __ayEq(a[key], b[key]));
+  }
+  return false;
+}
+
+// Thrown by value? to carry an err result out to the enclosing function
+class __ayPropagate {
+  constructor(result) {
+    this.result = result;
+  }
+}
+
+// value? : the value of an ok result, or an early return of an err result.
+// Values that aren't results pass through unchanged
+function __ayTry(result) {
+  if (result !== null && typeof result === "object") {
+    if (result.success === false) throw new __ayPropagate(result);
+    if (result.success === true && "value" in result) return result.value;
+  }
+  return result;
+}
+
+// Catch handler of functions that use '?': returns the carried err result and
+// rethrows anything else
+function __ayCaught(e) {
+  if (e instanceof __ayPropagate) return e.result;
+  throw e;
+}
+
+// Reports a failed assert, requires or ensures check and stops the program
+function __ayContractFailed(kind, message, line) {
+  console.error(`${kind} failed at line ${line}: ${message}`);
+  process.exit(1)
+}
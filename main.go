@@ -2,14 +2,20 @@ package main
 
 import (
 	_ "embed"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/MikeyA-yo/ay-go/parser"
 )
 
+//go:embed functions/runtime.js
+var runtimeF string
+
 //go:embed functions/arr.js
 var arrF string
 
@@ -34,6 +40,12 @@ var timeF string
 //go:embed functions/http.js
 var httpF string
 
+//go:embed functions/result.js
+var resultF string
+
+//go:embed functions/chan.js
+var chanF string
+
 const VERSION = "1.0.3"
 
 const AY_FancyName = `
@@ -51,21 +63,108 @@ AY Programming Language Compiler v%s
 A modern, expressive programming language that compiles to JavaScript.
 Features: Variables (l), Functions (f), Comments, Control Flow, Async Operations, and more!
 
-Usage: ay-go <filename>
-Example: ay-go myprogram.ay
+Usage: ay-go [options] <filename>
+       ay-go explain <code>
+Example: ay-go -D DEBUG myprogram.ay
+
+Use - as the filename to read from standard input and write JavaScript to standard output.
+
+Options:
+  -D NAME[=value]   Define NAME for #if blocks and def expansion (repeatable)
+  -keywords FILE    Use a keyword pack (overrides "keywordPack" in ay.json)
+  -ast              Print the parsed AST as JSON instead of compiling
+  -trivia           With -ast, print the whole file as one tree that keeps
+                    every token, whitespace and comment
+  -diagnostics FMT  Write errors and warnings as text (default) or json
+  -loose-eq         Compile == and != with JavaScript loose equality
+  -release          Leave out assert, requires and ensures checks
 
 Visit: https://github.com/MikeyA-yo/ay-go
 `, AY_FancyName, VERSION)
 
+// defineFlags collects repeated -D NAME=value flags
+type defineFlags map[string]string
+
+func (d defineFlags) String() string {
+	var parts []string
+	for name, value := range d {
+		parts = append(parts, name+"="+value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (d defineFlags) Set(s string) error {
+	name, value, _ := strings.Cut(s, "=")
+	if name == "" {
+		return fmt.Errorf("expected NAME or NAME=value")
+	}
+	d[name] = value
+	return nil
+}
+
+// colorStderr reports whether diagnostics should be colored: only when
+// stderr is a terminal, and never when NO_COLOR is set (https://no-color.org)
+func colorStderr() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// explain prints the explanation of each diagnostic code in args, for
+// "ay-go explain AY0012"
+func explain(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "⚠️  No code provided, for example: ay-go explain AY0012")
+		os.Exit(1)
+	}
+	for i, code := range args {
+		explanation, ok := parser.Explain(code)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "⚠️  Unknown diagnostic code %q\n", code)
+			os.Exit(1)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(explanation)
+	}
+}
+
 func main() {
+	defines := defineFlags{}
+	flag.Var(defines, "D", "define `NAME[=value]` for #if blocks and def expansion")
+	keywordPack := flag.String("keywords", "", "keyword pack `file` to use")
+	dumpAST := flag.Bool("ast", false, "print the parsed AST as JSON instead of compiling")
+	trivia := flag.Bool("trivia", false, "with -ast, keep every token, whitespace and comment in the tree")
+	diagnosticsFormat := flag.String("diagnostics", "text", "write errors and warnings as `text` or json")
+	looseEq := flag.Bool("loose-eq", false, "compile == and != with JavaScript loose equality")
+	release := flag.Bool("release", false, "leave out assert, requires and ensures checks")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, welcome)
+	}
+	flag.Parse()
+
 	// Check if filename is provided
-	if len(os.Args) < 2 {
+	if flag.NArg() < 1 {
 		fmt.Fprintln(os.Stderr, welcome)
 		fmt.Fprintln(os.Stderr, "⚠️  No filename provided")
 		os.Exit(1)
 	}
 
-	fileName := os.Args[1]
+	if flag.Arg(0) == "explain" {
+		explain(flag.Args()[1:])
+		return
+	}
+
+	fileName := flag.Arg(0)
+	fromStdin := fileName == "-"
+
+	if *diagnosticsFormat != "text" && *diagnosticsFormat != "json" {
+		fmt.Fprintf(os.Stderr, "⚠️  Unknown diagnostics format %q, expected text or json\n", *diagnosticsFormat)
+		os.Exit(1)
+	}
 
 	// Get current working directory and construct file path
 	cwd, err := os.Getwd()
@@ -76,40 +175,97 @@ func main() {
 
 	filePath := filepath.Join(cwd, fileName)
 
-	// Read the source file
-	fileText, err := os.ReadFile(filePath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", fileName, err)
-		os.Exit(1)
-	}
-
 	// Check file extension
 	fileNameParts := strings.Split(fileName, ".")
-	if len(fileNameParts) < 2 || fileNameParts[len(fileNameParts)-1] != "ay" {
+	if !fromStdin && (len(fileNameParts) < 2 || fileNameParts[len(fileNameParts)-1] != "ay") {
 		fmt.Fprintln(os.Stderr, welcome)
 		fmt.Fprintln(os.Stderr, "⚠️  Invalid file extension. Please use .ay files only.")
 		os.Exit(1)
 	}
 
-	p := parser.NewParser(string(fileText))
+	// Open the source; the parser reads it as it goes
+	source := os.Stdin
+	if fromStdin {
+		fileName = "<stdin>"
+		filePath = filepath.Join(cwd, fileName)
+	} else {
+		source, err = os.Open(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", fileName, err)
+			os.Exit(1)
+		}
+		defer source.Close()
+	}
+
+	parser.LoadBuiltins(arrF, mathF, stringF, printF, fsF, dateF, timeF, httpF, resultF, chanF)
+
+	// Load the keyword pack from the flag, falling back to the project config
+	config, err := loadProjectConfig(filepath.Dir(filePath))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading project config: %v\n", err)
+		os.Exit(1)
+	}
+	if *keywordPack == "" {
+		*keywordPack = config.KeywordPack
+	}
+	if *keywordPack != "" {
+		pack, err := parser.LoadKeywordPack(*keywordPack)
+		if err == nil {
+			err = parser.UseKeywordPack(pack)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading keyword pack: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	p := parser.NewParserReader(source, parser.Options{Defines: defines, Trivia: *trivia})
 	p.Start()
 
-	// Check for parsing errors
-	if len(p.Errors) > 0 {
-		fmt.Printf("Found %d parsing errors:\n", len(p.Errors))
-		for _, error := range p.Errors {
-			fmt.Printf("Error: %s\n", error)
+	// Errors and warnings go to stderr, in source order
+	diagnostics := append(slices.Clone(p.Errors), p.Warnings...)
+	slices.SortStableFunc(diagnostics, func(a, b parser.Diagnostic) int {
+		return a.Span.Start.Offset - b.Span.Start.Offset
+	})
+	var renderer parser.Renderer = parser.TextRenderer{File: fileName, Line: p.Line, Color: colorStderr()}
+	if *diagnosticsFormat == "json" {
+		renderer = parser.JSONRenderer{File: fileName}
+	}
+	if len(diagnostics) > 0 || *diagnosticsFormat == "json" {
+		if err := renderer.Render(os.Stderr, diagnostics); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing diagnostics: %v\n", err)
+			os.Exit(1)
 		}
-		fmt.Fprintf(os.Stderr, "%s Error encountered\nError compiling %s\n\n", AY_FancyName, fileName)
-		fmt.Fprintln(os.Stderr, "Errors:")
-		for _, error := range p.Errors {
-			fmt.Fprintln(os.Stderr, error)
+	}
+	if len(diagnostics) > 0 && *diagnosticsFormat == "text" {
+		fmt.Fprintf(os.Stderr, "For more about an error, run: ay-go explain %s\n", diagnostics[0].Code)
+	}
+	if len(p.Errors) > 0 {
+		if *diagnosticsFormat == "text" {
+			fmt.Fprintf(os.Stderr, "%s Error compiling %s: found %d error(s)\n", AY_FancyName, fileName, len(p.Errors))
 		}
 		os.Exit(1)
 	}
 
+	if *dumpAST {
+		var tree any = p.Nodes
+		if *trivia {
+			tree = p.Program()
+		}
+		ast, err := json.MarshalIndent(tree, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding AST: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(ast))
+		return
+	}
+
 	// Compile AST to JavaScript
-	compiled := parser.CompileAST(p.Nodes)
+	compiled := parser.CompileASTWithOptions(p.Nodes, parser.CompileOptions{
+		LooseEquality: *looseEq,
+		Release:       *release,
+	})
 
 	// Generate output with embedded function libraries
 	output := fmt.Sprintf(`
@@ -122,7 +278,16 @@ func main() {
 %s
 %s
 %s
-`, arrF, mathF, stringF, printF, fsF, dateF, timeF, compiled, httpF)
+%s
+%s
+%s
+`, runtimeF, arrF, mathF, stringF, printF, fsF, dateF, timeF, resultF, chanF, compiled, httpF)
+
+	// Source from stdin compiles to stdout
+	if fromStdin {
+		fmt.Print(output)
+		return
+	}
 
 	// Generate output filename
 	baseName := strings.Join(fileNameParts[:len(fileNameParts)-1], ".")
@@ -1,4 +1,176 @@
 
+// Runtime helpers for AY language
+// The compiler emits calls to these; they are not meant to be called directly
+
+// Reads seq[i], counting negative indices from the end of arrays and strings
+function __ayIndex(seq, i) {
+  if (typeof i === "number" && i < 0 && (Array.isArray(seq) || typeof seq === "string")) {
+    return seq[seq.length + i];
+  }
+  return seq[i];
+}
+
+// Returns the key to assign for seq[i] = value, counting negative indices from the end
+function __ayKey(seq, i) {
+  if (typeof i === "number" && i < 0 && Array.isArray(seq)) {
+    return seq.length + i;
+  }
+  return i;
+}
+
+// Python-style seq[start:end:step] for arrays and strings
+function __aySlice(seq, start, end, step = 1) {
+  if (!Array.isArray(seq) && typeof seq !== "string") {
+    console.error('Slicing needs an array or string but got,', typeof seq, 'instead');
+    process.exit(1)
+  }
+  if (step === 0) {
+    console.error('Slice step cannot be zero');
+    process.exit(1)
+  }
+
+  const n = seq.length;
+  const bound = (i, fallback, lo, hi) => {
+    if (i === undefined || i === null) return fallback;
+    if (i < 0) i += n;
+    return Math.min(Math.max(i, lo), hi);
+  };
+
+  if (step > 0) {
+    start = bound(start, 0, 0, n);
+    end = bound(end, n, 0, n);
+    if (step === 1) return seq.slice(start, Math.max(start, end));
+  } else {
+    start = bound(start, n - 1, -1, n - 1);
+    end = bound(end, -1, -1, n - 1);
+  }
+
+  const out = [];
+  for (let i = start; step > 0 ? i < end : i > end; i += step) {
+    out.push(seq[i]);
+  }
+  return typeof seq === "string" ? out.join("") : out;
+}
+
+// Iterable for a comprehension's for clause. Plain objects give their keys,
+// or [key, value] pairs when the clause unpacks more than one name
+function __ayIter(value, unpack) {
+  if (value !== null && value !== undefined && typeof value[Symbol.iterator] === "function") {
+    return value;
+  }
+  if (value !== null && typeof value === "object") {
+    return unpack ? Object.entries(value) : Object.keys(value);
+  }
+  console.error('Cannot iterate over', typeof value);
+  process.exit(1)
+}
+
+// Records are frozen objects made by a constructor from __ayRecord. Their
+// prototype remembers the record's name and fields.
+const __ayRecordInfo = Symbol("ayRecord");
+
+function __ayRecord(name, fields) {
+  const proto = {
+    toString() {
+      return require("util").inspect(this);
+    },
+    [Symbol.for("nodejs.util.inspect.custom")](depth, options, inspect) {
+      const parts = fields.map((field) => field + ": " + inspect(this[field], options));
+      return name + "(" + parts.join(", ") + ")";
+    },
+  };
+  Object.defineProperty(proto, __ayRecordInfo, { value: { name, fields } });
+
+  const make = (...values) => {
+    if (values.length !== fields.length) {
+      console.error(`${name} expects ${fields.length} field(s) but got ${values.length}`);
+      process.exit(1)
+    }
+    const record = Object.create(proto);
+    fields.forEach((field, i) => {
+      record[field] = values[i];
+    });
+    return Object.freeze(record);
+  };
+  return make;
+}
+
+// value with {field: x}: a copy of value with some fields changed
+function __ayWith(value, changes) {
+  const info = value !== null && typeof value === "object" ? value[__ayRecordInfo] : undefined;
+  if (!info) {
+    return Object.assign({}, value, changes);
+  }
+  for (const field of Object.keys(changes)) {
+    if (!info.fields.includes(field)) {
+      console.error(`${info.name} has no field ${field}`);
+      process.exit(1)
+    }
+  }
+  const copy = Object.create(Object.getPrototypeOf(value));
+  for (const field of info.fields) {
+    copy[field] = field in changes ? changes[field] : value[field];
+  }
+  return Object.freeze(copy);
+}
+
+// AY == and !=. Records, arrays and plain objects are equal when their contents
+// are; anything else is compared with ===, or == when loose is set (-loose-eq)
+function __ayEq(a, b, loose = false) {
+  if (a === b) return true;
+
+  const infoA = a !== null && typeof a === "object" ? a[__ayRecordInfo] : undefined;
+  const infoB = b !== null && typeof b === "object" ? b[__ayRecordInfo] : undefined;
+  if (infoA || infoB) {
+    return infoA === infoB && infoA.fields.every((field) => __ayEq(a[field], b[field], loose));
+  }
+  if (loose) return a == b;
+
+  if (Array.isArray(a) || Array.isArray(b)) {
+    return Array.isArray(a) && Array.isArray(b) && a.length === b.length &&
+      a.every((item, i) => __ayEq(item, b[i]));
+  }
+
+  const plain = (v) => v !== null && typeof v === "object" &&
+    [Object.prototype, null].includes(Object.getPrototypeOf(v));
+  if (plain(a) && plain(b)) {
+    const keys = Object.keys(a);
+    return keys.length === Object.keys(b).length &&
+      keys.every((key) => Object.hasOwn(b, key) && __ayEq(a[key], b[key]));
+  }
+  return false;
+}
+
+// Thrown by value? to carry an err result out to the enclosing function
+class __ayPropagate {
+  constructor(result) {
+    this.result = result;
+  }
+}
+
+// value? : the value of an ok result, or an early return of an err result.
+// Values that aren't results pass through unchanged
+function __ayTry(result) {
+  if (result !== null && typeof result === "object") {
+    if (result.success === false) throw new __ayPropagate(result);
+    if (result.success === true && "value" in result) return result.value;
+  }
+  return result;
+}
+
+// Catch handler of functions that use '?': returns the carried err result and
+// rethrows anything else
+function __ayCaught(e) {
+  if (e instanceof __ayPropagate) return e.result;
+  throw e;
+}
+
+// Reports a failed assert, requires or ensures check and stops the program
+function __ayContractFailed(kind, message, line) {
+  console.error(`${kind} failed at line ${line}: ${message}`);
+  process.exit(1)
+}
+
 function sort(arr, compareFn) {
     if (!Array.isArray(arr)) {
         console.error('Input must be an array');
@@ -441,6 +613,184 @@ function stopTimeout(timeoutId) {
 function stopInterval(intervalId) {
   clearInterval(intervalId);
 }
+// Result utilities for AY language
+// A result is { success: true, value } or { success: false, error }, the same
+// shape the HTTP helpers use for failures
+
+function ok(value) {
+  return { success: true, value: value };
+}
+
+function err(error) {
+  return { success: false, error: error };
+}
+
+function isOk(result) {
+  return result !== null && typeof result === "object" && result.success === true;
+}
+
+function isErr(result) {
+  return result !== null && typeof result === "object" && result.success === false;
+}
+
+// Value of an ok result, or fallback for an err result
+function unwrapOr(result, fallback) {
+  if (isErr(result)) return fallback;
+  return isOk(result) && "value" in result ? result.value : result;
+}
+
+// Channel utilities for AY language
+// Tasks started with spawn talk over channels. The compiler awaits send, recv,
+// sleep and select for you, so they read like blocking calls.
+
+class __ayChannel {
+  constructor(size) {
+    this.size = size;
+    this.buffer = [];
+    this.senders = []; // waiting senders: { value, take() }
+    this.receivers = []; // waiting receivers: (value) => taken
+    this.closed = false;
+  }
+
+  // Hands value to a waiting receiver or the buffer. Returns false if the
+  // sender has to wait.
+  trySend(value) {
+    if (this.closed) {
+      console.error("Cannot send on a closed channel");
+      process.exit(1)
+    }
+    while (this.receivers.length > 0) {
+      if (this.receivers.shift()(value)) return true;
+    }
+    if (this.buffer.length < this.size) {
+      this.buffer.push(value);
+      return true;
+    }
+    return false;
+  }
+
+  // Takes a value from the buffer or a waiting sender. A closed, empty
+  // channel gives undefined right away.
+  tryRecv() {
+    if (this.buffer.length > 0) {
+      const value = this.buffer.shift();
+      // Room in the buffer lets a waiting sender finish
+      while (this.senders.length > 0) {
+        const sender = this.senders.shift();
+        if (sender.take()) {
+          this.buffer.push(sender.value);
+          break;
+        }
+      }
+      return { ok: true, value };
+    }
+    while (this.senders.length > 0) {
+      const sender = this.senders.shift();
+      if (sender.take()) return { ok: true, value: sender.value };
+    }
+    if (this.closed) return { ok: true, value: undefined };
+    return { ok: false };
+  }
+}
+
+// Waiters share a state with the other cases of the same select, so only one
+// of them can fire
+function __ayReceiver(state, resolve) {
+  return (value) => {
+    if (state.done) return false;
+    state.done = true;
+    resolve(value);
+    return true;
+  };
+}
+
+function __aySender(state, value, resolve) {
+  return {
+    value,
+    take() {
+      if (state.done) return false;
+      state.done = true;
+      resolve();
+      return true;
+    },
+  };
+}
+
+// New channel. Unbuffered by default: a send waits until a receiver takes it
+function chan(size = 0) {
+  return new __ayChannel(size);
+}
+
+function send(ch, value) {
+  if (ch.trySend(value)) return Promise.resolve();
+  return new Promise((resolve) => {
+    ch.senders.push(__aySender({ done: false }, value, resolve));
+  });
+}
+
+// Next value from ch, or undefined once ch is closed and empty
+function recv(ch) {
+  const got = ch.tryRecv();
+  if (got.ok) return Promise.resolve(got.value);
+  return new Promise((resolve) => {
+    ch.receivers.push(__ayReceiver({ done: false }, resolve));
+  });
+}
+
+// Closes ch. Waiting receivers get undefined; sending afterwards is an error
+function closeChan(ch) {
+  ch.closed = true;
+  while (ch.receivers.length > 0) {
+    ch.receivers.shift()(undefined);
+  }
+  if (ch.senders.some((sender) => sender.take())) {
+    console.error("Cannot send on a closed channel");
+    process.exit(1)
+  }
+}
+
+function sleep(ms) {
+  return new Promise((resolve) => setTimeout(resolve, ms));
+}
+
+// Runs fn(...args) as a separate task. The arguments are evaluated by the
+// caller, so the task sees their values at the time of the spawn
+function __aySpawn(fn, args) {
+  Promise.resolve()
+    .then(() => fn(...args))
+    .catch((error) => {
+      console.error("Error in spawned task:", error);
+      process.exit(1)
+    });
+}
+
+// Waits for the first ready case of a select. cases are [ch, "recv"] or
+// [ch, "send", value]; the result is [case index, received value], with
+// index -1 for the default case
+function __aySelect(cases, hasDefault) {
+  for (let i = 0; i < cases.length; i++) {
+    const [ch, op, value] = cases[i];
+    if (op === "recv") {
+      const got = ch.tryRecv();
+      if (got.ok) return Promise.resolve([i, got.value]);
+    } else if (ch.trySend(value)) {
+      return Promise.resolve([i, undefined]);
+    }
+  }
+  if (hasDefault) return Promise.resolve([-1, undefined]);
+
+  return new Promise((resolve) => {
+    const state = { done: false };
+    cases.forEach(([ch, op, value], i) => {
+      if (op === "recv") {
+        ch.receivers.push(__ayReceiver(state, (got) => resolve([i, got])));
+      } else {
+        ch.senders.push(__aySender(state, value, () => resolve([i, undefined])));
+      }
+    });
+  });
+}
+
 let a = "my program variables are nicely scoped";
 let b = "hello world";
 let c = 6 + 3;
@@ -458,7 +808,7 @@ return greeting;
 }
 let userName = "Alice";
 let welcomeMessage = greet(userName);
-print(welcomeMessage)
+print(welcomeMessage);
 function factorial(n) {
 if ((n <= 1)) {
 return 1;
@@ -473,8 +823,8 @@ return fibonacci(n - 1) + fibonacci(n - 2);
 }
 let factResult = factorial(5);
 let fibResult = fibonacci(8);
-print(factResult)
-print(fibResult)
+print(factResult);
+print(fibResult);
 function foo(a) {
 if ((a > 0)) {
 let result = add(a, a);
@@ -483,62 +833,62 @@ return result;
 }
 let i = 0;
 while ((i < 5)) {
-print(i)
+print(i);
 i++;
 }
 for (let i = 0; (i < 8); i++) {
-print(i)
+print(i);
 }
 let doubleResult = foo(20);
-print(doubleResult)
+print(doubleResult);
 function randPrint() {
 if ((d > 6)) {
 let comparison = 0.5 < d;
-print(comparison)
-print(d)
+print(comparison);
+print(d);
 } else {
-print(d)
+print(d);
 }
 }
-randPrint()
+randPrint();
 let testingVar;
 
 
 
 
 let aliasedVariable = "This was declared using var alias!";
-print(aliasedVariable)
+print(aliasedVariable);
 function aliasedFunction(x, y) {
 let sum = x + y;
 return sum;
 }
 let aliasResult = aliasedFunction(10, 15);
-print(aliasResult)
+print(aliasResult);
 let counter = 0;
 while ((counter < 10)) {
-print(counter)
+print(counter);
 counter++;
-if ((counter == 3)) {
+if ((counter === 3)) {
 break;
 }
 }
 let numbers = [1, 2, 3, 4, 5];
-print(numbers, len(numbers))
+print(numbers, len(numbers));
 let complexCalc = factorial(4) + fibonacci(6);
-print(complexCalc)
+print(complexCalc);
 let mathResult = add(factorial(3), fibonacci(5));
-print(mathResult)
+print(mathResult);
 let asks = input("WHat you gonna type ei? ");
-print(asks, len(asks))
-let numberP = numbers[randInt(0, 4)];
-print(numberP)
+print(asks, len(asks));
+let numberP = __ayIndex(numbers, randInt(0, 4));
+print(numberP);
 while (true) {
-writestdout(0)
+writestdout(0);
 break;
 }
-writestdout("\n")
-writestdout("Hey ")
-writestdout("World\n")
+writestdout("\n");
+writestdout("Hey ");
+writestdout("World\n");
 let addComp = 8 + 9 - (7 / 6 * 8);
 // Functional HTTP utilities for AY language
 // All functions are pure and functional - no side effects, immutable data
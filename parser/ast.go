@@ -32,8 +32,16 @@ type ASTNode struct {
 	Elements []ASTNode `json:"elements,omitempty"`
 	Index    []ASTNode `json:"index,omitempty"`
 
+	// Slices (low:high:step), each part optional
+	Low  *ASTNode `json:"low,omitempty"`
+	High *ASTNode `json:"high,omitempty"`
+	Step *ASTNode `json:"step,omitempty"`
+
 	// Function calls
 	Args []ASTNode `json:"args,omitempty"`
+	// Indexes into Args in the order they were written, when named
+	// arguments put them in a different order
+	ArgOrder []int `json:"argOrder,omitempty"`
 
 	// Increment/Decrement
 	PostOp  string `json:"postOp,omitempty"`
@@ -41,6 +49,15 @@ type ASTNode struct {
 
 	// Loop specific
 	Upgrade *ASTNode `json:"upgrade,omitempty"`
+
+	// Contracts (assert, requires, ensures)
+	Contracts []ASTNode `json:"contracts,omitempty"`
+
+	// Source the node was parsed from
+	Span Span `json:"span"`
+	// With Options.Trivia, the tokens of the node that aren't part of a
+	// node under it, in source order
+	Tokens []Token `json:"tokens,omitempty"`
 }
 
 // Variable represents a variable in the parser's context
@@ -49,3 +66,41 @@ type Variable struct {
 	Val      string `json:"val"`
 	NodePos  int    `json:"nodePos"`
 }
+
+// children returns pointers to the nodes directly under n, so passes over the
+// tree can inspect or rewrite them in place
+func (n *ASTNode) children() []*ASTNode {
+	var out []*ASTNode
+	for _, child := range []*ASTNode{n.Left, n.Right, n.Initializer, n.Test, n.Consequent,
+		n.Alternate, n.Paren, n.Low, n.High, n.Step, n.Upgrade} {
+		if child != nil {
+			out = append(out, child)
+		}
+	}
+	for _, list := range [][]ASTNode{n.Body, n.Params, n.Elements, n.Index, n.Args, n.Contracts} {
+		for i := range list {
+			out = append(out, &list[i])
+		}
+	}
+	return out
+}
+
+// containsNode reports whether any of nodes is, or has inside it, a node of
+// type typ. Nested function declarations are not searched.
+func containsNode(nodes []ASTNode, typ int) bool {
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Type == typ {
+			return true
+		}
+		if node.Type == FunctionDeclaration {
+			continue
+		}
+		for _, child := range node.children() {
+			if containsNode([]ASTNode{*child}, typ) {
+				return true
+			}
+		}
+	}
+	return false
+}
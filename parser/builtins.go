@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Builtins maps each AY runtime function to its parameter names. It is filled
+// by LoadBuiltins from the JavaScript runtime sources embedded in the compiler.
+// A rest parameter keeps its "..." prefix.
+var Builtins = map[string][]string{}
+
+var builtinDecl = regexp.MustCompile(`(?m)^(?:function\s+([A-Za-z_$][\w$]*)\s*\(([^)]*)\)|const\s+([A-Za-z_$][\w$]*)\s*=\s*\(([^)]*)\)\s*=>)`)
+
+// LoadBuiltins registers the top-level functions declared in the given
+// runtime sources. Compiler-internal helpers (__ay...) are skipped.
+func LoadBuiltins(sources ...string) {
+	for _, src := range sources {
+		for _, m := range builtinDecl.FindAllStringSubmatch(src, -1) {
+			name, params := m[1], m[2]
+			if name == "" {
+				name, params = m[3], m[4]
+			}
+			if strings.HasPrefix(name, "__ay") {
+				continue
+			}
+			Builtins[name] = splitParams(params)
+		}
+	}
+}
+
+// splitParams turns a JS parameter list into bare names, dropping defaults
+func splitParams(params string) []string {
+	names := []string{}
+	for _, param := range strings.Split(params, ",") {
+		name, _, _ := strings.Cut(param, "=")
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// isBuiltin checks if name is an AY runtime function
+func isBuiltin(name string) bool {
+	_, exists := Builtins[name]
+	return exists
+}
+
+// hostObjects are JS globals whose own methods share names with AY built-ins
+// (console.log, Math.max, Date.now). Method calls on them stay JS method calls.
+var hostObjects = []string{
+	"console", "Math", "Date", "JSON", "Object", "Array", "Number", "String",
+	"Boolean", "Promise", "Reflect", "Intl", "process", "globalThis", "Buffer",
+	"Symbol", "BigInt", "Map", "Set", "URL",
+}
+
+// rewritesToBuiltin reports whether the method call recv.name(args) becomes
+// the built-in call name(recv, args). recv->name(args) never does.
+func rewritesToBuiltin(call ASTNode) bool {
+	if call.Operator == "->" {
+		return false
+	}
+	hostObject := call.Left.Type == IdentifierD && slices.Contains(hostObjects, call.Left.Value)
+	return isBuiltin(call.Identifier) && !hostObject
+}
@@ -0,0 +1,56 @@
+package parser
+
+// Diagnostic codes. Each names one kind of problem and keeps its meaning
+// once released, even if messages are reworded; retired codes are not reused.
+const (
+	// Reading the source
+	codeInvalidUTF8         = "AY0001"
+	codeUnterminatedString  = "AY0002"
+	codeUnterminatedComment = "AY0003"
+	codeUnexpectedCharacter = "AY0004"
+	codeUnknownOperator     = "AY0005"
+	codeReadFailed          = "AY0006"
+
+	// #if blocks and def
+	codeDirectiveSyntax = "AY0007"
+	codeUnbalancedIf    = "AY0008"
+	codeDefRecursion    = "AY0009"
+	codeDefArguments    = "AY0010"
+	codeDefSyntax       = "AY0011"
+
+	// Parsing and checking the program, by construct
+	codeUnexpectedToken  = "AY0012"
+	codeUnclosed         = "AY0013"
+	codeVariableSyntax   = "AY0014"
+	codeFunctionSyntax   = "AY0015"
+	codeContractSyntax   = "AY0016"
+	codeEnumSyntax       = "AY0017"
+	codeEnumValue        = "AY0018"
+	codeDuplicateMember  = "AY0019"
+	codeRecordSyntax     = "AY0020"
+	codeCallSyntax       = "AY0021"
+	codeArraySyntax      = "AY0022"
+	codeIndexSyntax      = "AY0023"
+	codeObjectSyntax     = "AY0024"
+	codeComprehension    = "AY0025"
+	codeIfSyntax         = "AY0026"
+	codeLoopSyntax       = "AY0027"
+	codeMatchSyntax      = "AY0028"
+	codePatternSyntax    = "AY0029"
+	codeBoundTwice       = "AY0030"
+	codeNoEnumMember     = "AY0031"
+	codeNonExhaustive    = "AY0032"
+	codeUnreachableArm   = "AY0033"
+	codeSelectSyntax     = "AY0034"
+	codeSpawnSyntax      = "AY0035"
+	codeOutsideFunction  = "AY0036"
+	codeMemberSyntax     = "AY0037"
+	codePipelineSyntax   = "AY0038"
+	codeSliceAssignment  = "AY0039"
+	codeResultParameter  = "AY0040"
+	codeNamedArgsUnknown = "AY0041"
+	codeNamedArgsOrder   = "AY0042"
+	codeNamedRestParam   = "AY0043"
+	codeNoSuchParameter  = "AY0044"
+	codeArgumentTwice    = "AY0045"
+)
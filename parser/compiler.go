@@ -1,19 +1,52 @@
 package parser
 
 import (
+	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 )
 
+// CompileOptions configures code generation
+type CompileOptions struct {
+	// LooseEquality compiles == and != with JS loose equality, as older AY did
+	LooseEquality bool
+	// Release leaves out assert, requires and ensures checks
+	Release bool
+}
+
+// compileOptions holds the options of the compile in progress
+var compileOptions CompileOptions
+
 // AST to JavaScript compiler for AY language
 // This function takes an AST (array of nodes) and returns JavaScript code as a string
 func CompileAST(ast []ASTNode) string {
+	return CompileASTWithOptions(ast, CompileOptions{})
+}
+
+// CompileASTWithOptions compiles an AST like CompileAST, with the given options
+func CompileASTWithOptions(ast []ASTNode, opts CompileOptions) string {
+	compileOptions = opts
+	defer func() { compileOptions = CompileOptions{} }()
+
 	var compiled []string
 	for _, node := range ast {
-		compiled = append(compiled, compileNode(node))
+		compiled = append(compiled, compileStatement(node))
 	}
 	return strings.Join(compiled, "\n")
 }
 
+// compileStatement compiles a node in statement position. Expression statements
+// get a closing semicolon, so a following line that starts with '(' (like a
+// match or comprehension IIFE) is not read as a call.
+func compileStatement(node ASTNode) string {
+	code := compileNode(node)
+	if code != "" && !strings.HasSuffix(code, ";") && !strings.HasSuffix(code, "}") {
+		code += ";"
+	}
+	return code
+}
+
 func compileNode(node ASTNode) string {
 	if node.Type == 0 && node.Value == "" {
 		return ""
@@ -45,13 +78,25 @@ func compileNode(node ASTNode) string {
 		}
 		var bodyStrs []string
 		for _, stmt := range node.Body {
-			bodyStrs = append(bodyStrs, compileNode(stmt))
+			bodyStrs = append(bodyStrs, compileStatement(stmt))
 		}
 		identifier := node.Identifier
 		if identifier == "" {
 			identifier = ""
 		}
-		return "function " + identifier + "(" + strings.Join(paramStrs, ", ") + ") {\n" + strings.Join(bodyStrs, "\n") + "\n}"
+		body := strings.Join(bodyStrs, "\n")
+		// '?' returns early by throwing the err result up to here
+		if containsNode(node.Body, TryExpression) {
+			body = "try {\n" + body + "\n} catch (__e) {\nreturn __ayCaught(__e);\n}"
+		}
+		if !compileOptions.Release && len(node.Contracts) > 0 {
+			body = compileContracts(node, body)
+		}
+		keyword := "function "
+		if isAsync(node.Body) {
+			keyword = "async function "
+		}
+		return keyword + identifier + "(" + strings.Join(paramStrs, ", ") + ") {\n" + body + "\n}"
 	case Return:
 		if node.Initializer != nil {
 			return "return " + compileNode(*node.Initializer) + ";"
@@ -68,24 +113,85 @@ func compileNode(node ASTNode) string {
 		return compileIfElse(node)
 	case Loop:
 		return compileLoop(node)
+	case Expression:
+		if node.Paren != nil {
+			return "(" + compileNode(*node.Paren) + ")"
+		}
+		return ""
 	case CallExpression:
+		if node.Left != nil {
+			return compileMethodCall(node)
+		}
+		return compileCall(node.Identifier, nil, node)
+	case UnaryExpression:
+		if node.Left != nil {
+			return node.Operator + compileNode(*node.Left)
+		}
+		return ""
+	case ArrayIndex:
+		return compileIndex(node)
+	case MemberExpression:
+		return compileNode(*node.Left) + "." + node.Identifier
+	case PipeExpression:
+		return compilePipe(node)
+	case ObjectExpr:
+		var props []string
+		for _, prop := range node.Elements {
+			props = append(props, objectKey(prop.Name)+": "+compileNode(*prop.Initializer))
+		}
+		if len(props) == 0 {
+			return "{}"
+		}
+		return "{ " + strings.Join(props, ", ") + " }"
+	case ListComprehension, MapComprehension:
+		return compileComprehension(node)
+	case MatchExpression:
+		return compileMatch(node)
+	case EnumDecl:
+		var members []string
+		for _, member := range node.Elements {
+			members = append(members, objectKey(member.Name)+": "+compileNode(*member.Initializer))
+		}
+		return "const " + node.Identifier + " = Object.freeze({ " + strings.Join(members, ", ") + " });"
+	case RecordDecl:
+		var fields []string
+		for _, field := range node.Params {
+			fields = append(fields, strconv.Quote(field.Name))
+		}
+		return "const " + node.Identifier + " = __ayRecord(" + strconv.Quote(node.Identifier) + ", [" + strings.Join(fields, ", ") + "]);"
+	case Contract:
+		if compileOptions.Release {
+			return ""
+		}
+		return compileCheck(node)
+	case SpawnStmt:
 		var argStrs []string
-		for _, arg := range node.Args {
+		for _, arg := range node.Initializer.Args {
 			argStrs = append(argStrs, compileNode(arg))
 		}
-		return node.Identifier + "(" + strings.Join(argStrs, ", ") + ")"
+		return "__aySpawn(" + node.Initializer.Identifier + ", [" + strings.Join(argStrs, ", ") + "]);"
+	case SelectStmt:
+		return compileSelect(node)
+	case TryExpression:
+		return "__ayTry(" + compileNode(*node.Left) + ")"
+	case AwaitExpression:
+		return "await " + compileNode(*node.Left)
+	case WithExpression:
+		return "__ayWith(" + compileNode(*node.Left) + ", " + compileNode(*node.Right) + ")"
 	default:
 		// Handle binary, unary, array, etc.
 		if node.Operator != "" && node.Left != nil && node.Right != nil {
 			// Handle string concatenation and other binary operations
-			left := compileNode(*node.Left)
 			var right string
 			if node.Right != nil && node.Right.Paren != nil {
 				right = compileTest(*node.Right)
 			} else {
 				right = compileNode(*node.Right)
 			}
-			return left + " " + node.Operator + " " + right
+			if isAssignmentOperator(node.Operator) && node.Left.Type == ArrayIndex {
+				return compileIndexAssignment(*node.Left, node.Operator, right)
+			}
+			return compileBinary(compileNode(*node.Left), node, right)
 		}
 		if node.PostOp != "" && node.Identifier != "" {
 			return node.Identifier + node.PostOp + ";"
@@ -101,13 +207,6 @@ func compileNode(node ASTNode) string {
 			}
 			return "[" + strings.Join(elemStrs, ", ") + "]"
 		}
-		if node.Identifier != "" && len(node.Index) > 0 {
-			var indexStrs []string
-			for _, idx := range node.Index {
-				indexStrs = append(indexStrs, compileNode(idx))
-			}
-			return node.Identifier + "[" + strings.Join(indexStrs, "][") + "]"
-		}
 		if node.Value != "" {
 			return node.Value
 		}
@@ -130,7 +229,7 @@ func compileIfElse(node ASTNode) string {
 
 	var consStrs []string
 	for _, stmt := range cons {
-		consStrs = append(consStrs, compileNode(stmt))
+		consStrs = append(consStrs, compileStatement(stmt))
 	}
 
 	code := "if (" + test + ") {\n" + strings.Join(consStrs, "\n") + "\n}"
@@ -139,7 +238,7 @@ func compileIfElse(node ASTNode) string {
 		if len(node.Alternate.Body) > 0 {
 			var altStrs []string
 			for _, stmt := range node.Alternate.Body {
-				altStrs = append(altStrs, compileNode(stmt))
+				altStrs = append(altStrs, compileStatement(stmt))
 			}
 			code += " else {\n" + strings.Join(altStrs, "\n") + "\n}"
 		} else if node.Alternate.Type == IfElse {
@@ -152,10 +251,10 @@ func compileIfElse(node ASTNode) string {
 
 func compileTest(test ASTNode) string {
 	if test.Paren != nil && test.Paren.Left != nil && test.Paren.Operator != "" && test.Paren.Right != nil {
-		return "(" + compileNode(*test.Paren.Left) + " " + test.Paren.Operator + " " + compileNode(*test.Paren.Right) + ")"
+		return "(" + compileBinary(compileNode(*test.Paren.Left), *test.Paren, compileNode(*test.Paren.Right)) + ")"
 	}
 	if test.Operator != "" && test.Left != nil && test.Right != nil {
-		return "(" + compileNode(*test.Left) + " " + test.Operator + " " + compileNode(*test.Right) + ")"
+		return "(" + compileBinary(compileNode(*test.Left), test, compileNode(*test.Right)) + ")"
 	}
 	// Handle boolean values that come like { paren: "true" } or { paren: "false" }
 	if test.Paren != nil && test.Paren.Value != "" {
@@ -164,10 +263,36 @@ func compileTest(test ASTNode) string {
 	return compileNode(test)
 }
 
+// compileBinary joins the compiled operands of a binary expression. == and !=
+// are strict, and go through __ayEq so records, arrays and objects compare by
+// their contents. A comparison with a literal can skip the helper.
+func compileBinary(left string, node ASTNode, right string) string {
+	if node.Operator != "==" && node.Operator != "!=" {
+		return left + " " + node.Operator + " " + right
+	}
+
+	if node.Left.Type == LiteralD || node.Right.Type == LiteralD {
+		operator := node.Operator
+		if !compileOptions.LooseEquality {
+			operator += "="
+		}
+		return left + " " + operator + " " + right
+	}
+
+	args := left + ", " + right
+	if compileOptions.LooseEquality {
+		args += ", true"
+	}
+	if node.Operator == "!=" {
+		return "!__ayEq(" + args + ")"
+	}
+	return "__ayEq(" + args + ")"
+}
+
 func compileLoop(node ASTNode) string {
 	// For loop
 	if node.Initializer != nil && node.Test != nil && node.Upgrade != nil {
-		init := compileNode(*node.Initializer)
+		init := compileStatement(*node.Initializer)
 		test := compileTest(*node.Test)
 		upgrade := compileNode(*node.Upgrade)
 		// Always remove trailing semicolon from upgrade
@@ -175,7 +300,7 @@ func compileLoop(node ASTNode) string {
 
 		var bodyStrs []string
 		for _, stmt := range node.Body {
-			bodyStrs = append(bodyStrs, compileNode(stmt))
+			bodyStrs = append(bodyStrs, compileStatement(stmt))
 		}
 
 		return "for (" + init + " " + test + "; " + upgrade + ") {\n" + strings.Join(bodyStrs, "\n") + "\n}"
@@ -186,10 +311,391 @@ func compileLoop(node ASTNode) string {
 		test := compileTest(*node.Test)
 		var bodyStrs []string
 		for _, stmt := range node.Body {
-			bodyStrs = append(bodyStrs, compileNode(stmt))
+			bodyStrs = append(bodyStrs, compileStatement(stmt))
 		}
 		return "while (" + test + ") {\n" + strings.Join(bodyStrs, "\n") + "\n}"
 	}
 
 	return ""
 }
+
+// compileIndex compiles reads like arr[i], arr[-1] and arr[1:3]. Indices that
+// could be negative and slices go through runtime helpers, since plain JS
+// indexing returns undefined for them.
+func compileIndex(node ASTNode) string {
+	code := indexObject(node)
+	for _, idx := range node.Index {
+		code = compileIndexStep(code, idx)
+	}
+	return code
+}
+
+func compileIndexStep(object string, idx ASTNode) string {
+	if idx.Type == SliceExpr {
+		parts := []string{object}
+		for _, part := range []*ASTNode{idx.Low, idx.High, idx.Step} {
+			if part != nil {
+				parts = append(parts, compileNode(*part))
+			} else {
+				parts = append(parts, "undefined")
+			}
+		}
+		// Leave out trailing parts that were not given
+		for parts[len(parts)-1] == "undefined" {
+			parts = parts[:len(parts)-1]
+		}
+		return "__aySlice(" + strings.Join(parts, ", ") + ")"
+	}
+	if isPlainIndex(idx) {
+		return object + "[" + compileNode(idx) + "]"
+	}
+	return "__ayIndex(" + object + ", " + compileNode(idx) + ")"
+}
+
+// compileIndexAssignment compiles arr[i] op value. An index that could be
+// negative goes through __ayKey, which needs the array as well as the index;
+// unless the array is a plain name it is passed into an arrow function, so
+// that arr is still evaluated once, like m[g()][-1] = v calling g() once.
+func compileIndexAssignment(node ASTNode, operator, value string) string {
+	object := indexObject(node)
+	for _, idx := range node.Index[:len(node.Index)-1] {
+		object = compileIndexStep(object, idx)
+	}
+	last := node.Index[len(node.Index)-1]
+	switch {
+	case isPlainIndex(last):
+		return object + "[" + compileNode(last) + "] " + operator + " " + value
+	case len(node.Index) == 1 && node.Left == nil:
+		return object + "[__ayKey(" + object + ", " + compileNode(last) + ")] " + operator + " " + value
+	}
+	return "((seq, i, value) => seq[__ayKey(seq, i)] " + operator + " value)(" + object + ", " + compileNode(last) + ", " + value + ")"
+}
+
+// indexObject compiles the value being indexed: a name, or any expression for expr[i]
+func indexObject(node ASTNode) string {
+	if node.Left != nil {
+		return compileNode(*node.Left)
+	}
+	return node.Identifier
+}
+
+// compileMethodCall compiles recv.name(args). When name is an AY built-in the
+// call is rewritten to name(recv, args), so chains read left to right:
+// arr.filter(isEven).len() becomes len(filter(arr, isEven)). Other names,
+// methods of JS globals like console and Math, and recv->name(args) stay JS
+// method calls.
+func compileMethodCall(node ASTNode) string {
+	receiver := compileNode(*node.Left)
+	if rewritesToBuiltin(node) {
+		return compileCall(node.Identifier, []string{receiver}, node)
+	}
+	return compileCall(receiver+"."+node.Identifier, nil, node)
+}
+
+// compileCall writes callee(leading..., args...). When named arguments were
+// put in parameter order, an arrow function is called with the arguments in
+// the order they were written, so they still run in that order, and passes
+// them on in parameter order: f(b: g(), a: h()) becomes
+// ((__ayArg0, __ayArg1) => f(__ayArg1, __ayArg0))(g(), h())
+func compileCall(callee string, leading []string, node ASTNode) string {
+	args := slices.Clone(leading)
+	for _, arg := range node.Args {
+		args = append(args, compileNode(arg))
+	}
+	if node.ArgOrder == nil {
+		return callee + "(" + strings.Join(args, ", ") + ")"
+	}
+
+	// Leading values, like a method's receiver, are written first
+	var params, values []string
+	passed := slices.Clone(args)
+	for i := range leading {
+		params = append(params, fmt.Sprintf("__ayArg%d", len(params)))
+		values = append(values, args[i])
+		passed[i] = params[len(params)-1]
+	}
+	for _, idx := range node.ArgOrder {
+		params = append(params, fmt.Sprintf("__ayArg%d", len(params)))
+		values = append(values, args[len(leading)+idx])
+		passed[len(leading)+idx] = params[len(params)-1]
+	}
+	return "((" + strings.Join(params, ", ") + ") => " + callee + "(" + strings.Join(passed, ", ") + "))(" + strings.Join(values, ", ") + ")"
+}
+
+// compilePipe rewrites value |> target into a call of target. The value goes in
+// place of the '_' placeholder if target's arguments have one, otherwise first.
+func compilePipe(node ASTNode) string {
+	value := *node.Left
+	target := *node.Right
+
+	switch target.Type {
+	case IdentifierD:
+		return compileNode(ASTNode{Type: CallExpression, Identifier: target.Value, Args: []ASTNode{value}})
+	case MemberExpression:
+		return compileNode(ASTNode{Type: CallExpression, Identifier: target.Identifier, Left: target.Left, Args: []ASTNode{value}})
+	case CallExpression:
+		var args []ASTNode
+		if countPlaceholders(target.Args) > 0 {
+			var first []int
+			for i, arg := range target.Args {
+				if arg.Type == IdentifierD && arg.Value == "_" {
+					arg = value
+					first = append(first, i)
+				}
+				args = append(args, arg)
+			}
+			// The piped value is written before the arguments
+			if target.ArgOrder != nil {
+				rest := slices.DeleteFunc(slices.Clone(target.ArgOrder), func(idx int) bool { return slices.Contains(first, idx) })
+				target.ArgOrder = append(first, rest...)
+			}
+		} else {
+			args = append([]ASTNode{value}, target.Args...)
+			// The piped value is written before the arguments
+			if target.ArgOrder != nil {
+				order := []int{0}
+				for _, idx := range target.ArgOrder {
+					order = append(order, idx+1)
+				}
+				target.ArgOrder = order
+			}
+		}
+		target.Args = args
+		return compileNode(target)
+	}
+
+	// Any other expression is called with the value
+	return "(" + compileNode(target) + ")(" + compileNode(value) + ")"
+}
+
+// objectKey writes an object literal key, quoting it unless it is a plain name or number
+func objectKey(name string) string {
+	if isIdentifier(name) || (name != "" && name[0] >= '0' && name[0] <= '9') {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+// compileComprehension compiles [x * 2 for x in xs if x > 0] and
+// {k: v for k, v in pairs} into loops inside an IIFE, so loop variables
+// stay scoped to the comprehension.
+func compileComprehension(node ASTNode) string {
+	var add string
+	if node.Type == ListComprehension {
+		add = "__out.push(" + compileNode(*node.Initializer) + ");"
+	} else {
+		add = "__out[" + compileNode(*node.Left) + "] = " + compileNode(*node.Right) + ";"
+	}
+
+	code := add
+	for i := len(node.Body) - 1; i >= 0; i-- {
+		clause := node.Body[i]
+		if clause.Type == CompIf {
+			code = "if (" + compileNode(*clause.Test) + ") {\n" + code + "\n}"
+			continue
+		}
+		var target string
+		unpack := "false"
+		if len(clause.Params) == 1 {
+			target = clause.Params[0].Value
+		} else {
+			var names []string
+			for _, param := range clause.Params {
+				names = append(names, param.Value)
+			}
+			target = "[" + strings.Join(names, ", ") + "]"
+			unpack = "true"
+		}
+		code = "for (const " + target + " of __ayIter(" + compileNode(*clause.Right) + ", " + unpack + ")) {\n" + code + "\n}"
+	}
+
+	out := "[]"
+	if node.Type == MapComprehension {
+		out = "{}"
+	}
+	return compileIIFE(node, "const __out = "+out+";\n"+code+"\nreturn __out;")
+}
+
+// isAsync reports whether code has to run in an async function
+func isAsync(nodes []ASTNode) bool {
+	return containsNode(nodes, AwaitExpression) || containsNode(nodes, SelectStmt)
+}
+
+// compileSelect compiles a select statement into a wait on __aySelect
+// followed by the body of the case that fired
+func compileSelect(node ASTNode) string {
+	var ops []string
+	var branches []string
+	defaultBody := ""
+	for _, selectCase := range node.Body {
+		var stmts []string
+		for _, stmt := range selectCase.Consequent.Body {
+			stmts = append(stmts, compileStatement(stmt))
+		}
+		body := strings.Join(stmts, "\n")
+
+		if selectCase.Initializer == nil {
+			defaultBody = body
+			continue
+		}
+		op := selectCase.Initializer
+		desc := "[" + compileNode(op.Args[0]) + ", " + strconv.Quote(op.Identifier)
+		if op.Identifier == "send" {
+			desc += ", " + compileNode(op.Args[1])
+		}
+		ops = append(ops, desc+"]")
+
+		if selectCase.Identifier != "" {
+			body = "const " + selectCase.Identifier + " = __v;\n" + body
+		}
+		branches = append(branches, "if (__i === "+strconv.Itoa(len(ops)-1)+") {\n"+body+"\n}")
+	}
+
+	hasDefault := "false"
+	for _, selectCase := range node.Body {
+		if selectCase.Initializer == nil {
+			hasDefault = "true"
+			branches = append(branches, "{\n"+defaultBody+"\n}")
+		}
+	}
+
+	return "{\nconst [__i, __v] = await __aySelect([" + strings.Join(ops, ", ") + "], " + hasDefault + ");\n" +
+		strings.Join(branches, " else ") + "\n}"
+}
+
+// contractKinds names each contract in failure reports
+var contractKinds = map[string]string{
+	"assert":   "Assertion",
+	"requires": "Precondition",
+	"ensures":  "Postcondition",
+}
+
+// compileCheck compiles one contract into a runtime check
+func compileCheck(node ASTNode) string {
+	message := strconv.Quote(node.Value)
+	if node.Initializer != nil {
+		message = compileNode(*node.Initializer)
+	}
+	return "if (!(" + compileNode(*node.Test) + ")) __ayContractFailed(" + strconv.Quote(contractKinds[node.Name]) +
+		", " + message + ", " + strconv.Itoa(node.Span.Start.Line) + ");"
+}
+
+// compileContracts adds a function's requires checks before its body and its
+// ensures checks after it. With ensures clauses the body runs as an inner
+// function, so every return passes through the checks as result.
+func compileContracts(node ASTNode, body string) string {
+	var before, after []string
+	for _, clause := range node.Contracts {
+		if clause.Name == "requires" {
+			before = append(before, compileCheck(clause))
+		} else {
+			after = append(after, compileCheck(clause))
+		}
+	}
+	if len(after) > 0 {
+		body = "const result = " + compileIIFE(ASTNode{Type: BlockStmt, Body: node.Body}, body) + ";\n" +
+			strings.Join(after, "\n") + "\nreturn result;"
+	}
+	return strings.Join(append(before, body), "\n")
+}
+
+// compileIIFE wraps the code of an expression that needs statements, like a
+// match or comprehension, in a function that is called right away. If the
+// expression awaits, the function is async and its result awaited.
+func compileIIFE(node ASTNode, code string) string {
+	if isAsync([]ASTNode{node}) {
+		return "(await (async () => {\n" + code + "\n})())"
+	}
+	return "(() => {\n" + code + "\n})()"
+}
+
+// compileMatch compiles a match expression into an IIFE that tests each arm
+// in order and returns the first matching arm's value
+func compileMatch(node ASTNode) string {
+	code := "const __m = " + compileNode(*node.Test) + ";\n"
+
+	for _, arm := range node.Body {
+		var tests []string
+		var binds []string
+		compilePattern(*arm.Left, "__m", &tests, &binds)
+
+		var body string
+		if arm.Consequent.Type == BlockStmt {
+			var stmts []string
+			for _, stmt := range arm.Consequent.Body {
+				stmts = append(stmts, compileStatement(stmt))
+			}
+			// A block that finishes without returning gives undefined
+			body = strings.Join(append(stmts, "return;"), "\n")
+		} else {
+			body = "return " + compileNode(*arm.Consequent) + ";"
+		}
+		if arm.Test != nil {
+			body = "if (" + compileNode(*arm.Test) + ") {\n" + body + "\n}"
+		}
+		if len(binds) > 0 {
+			body = strings.Join(binds, "\n") + "\n" + body
+		}
+
+		if len(tests) > 0 {
+			code += "if (" + strings.Join(tests, " && ") + ") {\n" + body + "\n}\n"
+		} else {
+			code += "{\n" + body + "\n}\n"
+		}
+	}
+
+	code += "throw new Error(\"No match arm matched \" + JSON.stringify(__m));"
+	return compileIIFE(node, code)
+}
+
+// compilePattern adds the tests a value at access must pass to match pattern,
+// and the bindings the pattern introduces
+func compilePattern(pattern ASTNode, access string, tests, binds *[]string) {
+	switch pattern.Type {
+	case IdentifierD:
+		if pattern.Value != "_" {
+			*binds = append(*binds, "const "+pattern.Value+" = "+access+";")
+		}
+	case LiteralD, MemberExpression:
+		*tests = append(*tests, access+" === "+compileNode(pattern))
+	case ArrayExpr:
+		*tests = append(*tests, "Array.isArray("+access+")")
+		if pattern.Right != nil {
+			*tests = append(*tests, access+".length >= "+strconv.Itoa(len(pattern.Elements)))
+		} else {
+			*tests = append(*tests, access+".length === "+strconv.Itoa(len(pattern.Elements)))
+		}
+		for i, element := range pattern.Elements {
+			compilePattern(element, access+"["+strconv.Itoa(i)+"]", tests, binds)
+		}
+		if pattern.Right != nil {
+			*binds = append(*binds, "const "+pattern.Right.Value+" = "+access+".slice("+strconv.Itoa(len(pattern.Elements))+");")
+		}
+	case ObjectExpr:
+		*tests = append(*tests, access+" !== null", "typeof "+access+" === \"object\"")
+		for _, prop := range pattern.Elements {
+			var propAccess string
+			if isIdentifier(prop.Name) {
+				propAccess = access + "." + prop.Name
+			} else {
+				propAccess = access + "[" + strconv.Quote(prop.Name) + "]"
+			}
+			// Bare names and _ still need the key to be there
+			if prop.Initializer.Type == IdentifierD {
+				*tests = append(*tests, strconv.Quote(prop.Name)+" in "+access)
+			}
+			compilePattern(*prop.Initializer, propAccess, tests, binds)
+		}
+	}
+}
+
+// isPlainIndex reports whether an index is a literal that JS indexing handles as is
+func isPlainIndex(idx ASTNode) bool {
+	if idx.Type != LiteralD {
+		return false
+	}
+	if strings.HasPrefix(idx.Value, "\"") || strings.HasPrefix(idx.Value, "'") {
+		return true
+	}
+	return idx.Value != "" && idx.Value[0] >= '0' && idx.Value[0] <= '9'
+}
@@ -0,0 +1,403 @@
+package parser
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runtimeSources are the JavaScript runtime files, as the compiler embeds them
+var runtimeSources []string
+
+func TestMain(m *testing.M) {
+	files, err := filepath.Glob("../functions/*.js")
+	if err != nil || len(files) == 0 {
+		panic("runtime sources not found in ../functions")
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		runtimeSources = append(runtimeSources, string(src))
+	}
+	LoadBuiltins(runtimeSources...)
+	os.Exit(m.Run())
+}
+
+// compileSource parses and compiles src, failing the test on any error
+func compileSource(t *testing.T, src string) string {
+	t.Helper()
+	return compileSourceWith(t, src, CompileOptions{})
+}
+
+// compileSourceWith is compileSource with the given compile options
+func compileSourceWith(t *testing.T, src string, opts CompileOptions) string {
+	t.Helper()
+	p := NewParser(src)
+	p.Start()
+	for _, d := range p.Errors {
+		t.Errorf("%d:%d: %s", d.Span.Start.Line, d.Span.Start.Col, d.Message)
+	}
+	if t.Failed() {
+		t.FailNow()
+	}
+	return CompileASTWithOptions(p.Nodes, opts)
+}
+
+// runProgram compiles src and runs it with node along with the runtime,
+// returning what it writes to stdout. The test is skipped without node.
+func runProgram(t *testing.T, src string) string {
+	t.Helper()
+	out, err := runCompiled(t, compileSource(t, src))
+	if err != nil {
+		t.Fatalf("running %s: %v", src, err)
+	}
+	return out
+}
+
+// runCompiled runs compiled JavaScript with node along with the runtime,
+// returning its stdout. A failed run's stderr is in the *exec.ExitError.
+func runCompiled(t *testing.T, js string) (string, error) {
+	t.Helper()
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node is not installed")
+	}
+	file := filepath.Join(t.TempDir(), "program.js")
+	program := strings.Join(append(runtimeSources, js), "\n")
+	if err := os.WriteFile(file, []byte(program), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(node, file).Output()
+	return string(out), err
+}
+
+func TestIndexAssignmentEvaluatesObjectOnce(t *testing.T) {
+	tests := []struct {
+		src   string
+		calls int
+	}{
+		{"m[g()][-1] = 9", 1},
+		{"m[g()][k] += 1", 1},
+		{"m[g()][0] = 9", 1},
+	}
+	for _, test := range tests {
+		js := compileSource(t, test.src)
+		if n := strings.Count(js, "g()"); n != test.calls {
+			t.Errorf("%s compiles to %s, which calls g() %d times, want %d", test.src, js, n, test.calls)
+		}
+	}
+}
+
+func TestIndexAssignmentToName(t *testing.T) {
+	js := compileSource(t, "arr[-1] = 9")
+	if want := "arr[__ayKey(arr, -1)] = 9;"; js != want {
+		t.Errorf("got %s, want %s", js, want)
+	}
+}
+
+func TestMethodCallRewritesToBuiltin(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		// Built-in names are AY built-ins, even where JS has a method of that name
+		{"print([1, 2, 3].push(4).len())", "4\n"},
+		{`print("hello".upper().len())`, "5\n"},
+		// -> calls the value's own method
+		{"l a = [1, 2, 3]\nprint(a->push(4), a.len())", "4 4\n"},
+		{`process.stdout->write("hi\n")`, "hi\n"},
+		{"l box = { len: f() { return 42 } }\nprint(box->len())", "42\n"},
+		// Methods of JS globals stay JS methods
+		{"print(Math.max(1, 3))", "3\n"},
+	}
+	for _, test := range tests {
+		if got := runProgram(t, test.src); got != test.want {
+			t.Errorf("%s printed %q, want %q", test.src, got, test.want)
+		}
+	}
+
+	if js := compileSource(t, "l n = a.len()"); js != "let n = len(a);" {
+		t.Errorf("a.len() compiles to %s, want a call of the built-in", js)
+	}
+}
+
+func TestMacrosKeepPrecedence(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"def square(x) -> x * x\nprint(square(3 + 1))", "16\n"},
+		{"def square(x) -> (x * x)\nprint(square(3 + 1))", "16\n"},
+		{"def two -> 1 + 1\nprint(two * 3)", "6\n"},
+		{"def neg(x) -> -x\nprint(neg(1 - 3))", "2\n"},
+		// Statements and keywords are spliced in as they are
+		{"def var -> l\nvar x = 2 + 3\nprint(x)", "5\n"},
+		{"def decl(n, v) -> l n = v\ndecl(y, 5 - 1)\nprint(y)", "4\n"},
+	}
+	for _, test := range tests {
+		if got := runProgram(t, test.src); got != test.want {
+			t.Errorf("%q printed %q, want %q", test.src, got, test.want)
+		}
+	}
+}
+
+func TestKeywordPackPropertyNames(t *testing.T) {
+	if err := UseKeywordPack(&KeywordPack{Name: "test", Builtins: map[string]string{"len": "longitud"}}); err != nil {
+		t.Fatal(err)
+	}
+	defer UseKeywordPack(nil)
+
+	// Property names keep the spelling used; calls still reach the built-in
+	src := `l o = { longitud: 3 }
+l s = { longitud }
+record Box(longitud)
+enum Size { longitud, width }
+print(o.longitud, "abc".longitud(), longitud([1, 2]), s.longitud == longitud)
+print(Box(5).longitud, Box(longitud: 6).longitud, Size.longitud)`
+	if got, want := runProgram(t, src), "3 3 2 true\n5 6 0\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+
+	p := NewParser("longitud(1, nope: 2)\n")
+	p.Start()
+	if len(p.Errors) != 1 || !strings.HasPrefix(p.Errors[0].Message, "'longitud' has no parameter named 'nope'") {
+		t.Errorf("got %v, want the built-in named as written", p.Errors)
+	}
+}
+
+func TestNamedArgsRunInWrittenOrder(t *testing.T) {
+	src := `l seen = []
+f g(v) {
+  seen.push(v)
+  return v
+}
+f sub(a, b) { return a - b }
+print(sub(b: g(1), a: g(10)))
+print(g([1, 2, 3, 4]).slice(end: g(3), start: g(1)))
+print(g(20) |> sub(b: g(2)))
+print(g(30) |> sub(b: g(5), a: _))
+print(seen)`
+	want := "9\n[ 2, 3 ]\n18\n25\n[ 1, 10, [ 1, 2, 3, 4 ], 3, 1, 20, 2, 30, 5 ]\n"
+	if got := runProgram(t, src); got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+
+	// Arguments whose order can't matter are passed without the wrapper
+	if js := compileSource(t, "f sub(a, b) { return a - b }\nsub(b: x, a: 1)"); strings.Contains(js, "=>") {
+		t.Errorf("got %s, want a plain call", js)
+	}
+}
+
+func TestMatchRuns(t *testing.T) {
+	src := `f describe(v) {
+  return match v {
+    0 => "zero"
+    [x, y] => "pair " + (x + y)
+    [first, ...rest] => "list of " + (len(rest) + 1)
+    {kind: "err", msg} => "error: " + msg
+    n if n > 100 => "big"
+    _ => "other"
+  }
+}
+print(describe(0))
+print(describe([1, 2]))
+print(describe([1, 2, 3]))
+print(describe({kind: "err", msg: "boom"}))
+print(describe(101))
+print(describe(5))`
+	want := "zero\npair 3\nlist of 3\nerror: boom\nbig\nother\n"
+	if got := runProgram(t, src); got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
+
+func TestEnumMatchRuns(t *testing.T) {
+	src := `enum Color { Red, Green, Blue }
+enum Status { Ok = 200, NotFound = 404, Gone }
+f hex(c) {
+  return match c {
+    Color.Red => "#f00"
+    Color.Green => "#0f0"
+    Color.Blue => "#00f"
+  }
+}
+print(hex(Color.Green), Color.Blue, Status.NotFound, Status.Gone)`
+	want := "#0f0 2 404 405\n"
+	if got := runProgram(t, src); got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
+
+func TestEnumMatchMustBeExhaustive(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // the error, or "" for none
+	}{
+		{"enum Color { Red, Green, Blue }\nl c = Color.Red\nl v = match c {\n  Color.Red => 1\n}",
+			"match over enum 'Color' does not cover Color.Green, Color.Blue"},
+		{"enum Color { Red, Green, Blue }\nl c = Color.Red\nl v = match c {\n  Color.Red => 1\n  _ => 2\n}", ""},
+		{"enum Color { Red, Green }\nl c = Color.Red\nl v = match c {\n  Color.Red => 1\n  Color.Green => 2\n}", ""},
+	}
+	for _, test := range tests {
+		p := NewParser(test.src)
+		p.Start()
+		var got string
+		if len(p.Errors) > 0 {
+			got = p.Errors[0].Message
+		}
+		if got != test.want || len(p.Errors) > 1 {
+			t.Errorf("%q: got errors %v, want %q", test.src, p.Errors, test.want)
+		}
+	}
+}
+
+func TestRecordsRun(t *testing.T) {
+	src := `record Point(x, y)
+l p = Point(1, 2)
+l q = p with { x: 3 }
+print(p == Point(1, 2), p == q, p != q, q.x, q.y, p.x)
+print(q)`
+	want := "true false true 3 2 1\nPoint(x: 3, y: 2)\n"
+	if got := runProgram(t, src); got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
+
+func TestEqualityRuns(t *testing.T) {
+	src := `print(1 == "1", 1 != "1", [1, [2]] == [1, [2]], {a: 1} == {a: 1}, [1] == [2])`
+	want := "false true true true false\n"
+	if got := runProgram(t, src); got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+
+	// -loose-eq compiles back to JavaScript's loose equality
+	js := compileSourceWith(t, src, CompileOptions{LooseEquality: true})
+	out, err := runCompiled(t, js)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "true false false false false\n"; out != want {
+		t.Errorf("with loose equality printed %q, want %q", out, want)
+	}
+}
+
+func TestResultsRun(t *testing.T) {
+	src := `f parsePort(text) {
+  if (text == "") {
+    return err("no port given")
+  }
+  return ok(Number(text))
+}
+f doubled(text) {
+  l port = parsePort(text)?
+  return ok(port * 2)
+}
+l good = doubled("40")
+l bad = doubled("")
+print(good.success, good.value)
+print(bad.success, bad.error)`
+	want := "true 80\nfalse no port given\n"
+	if got := runProgram(t, src); got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
+
+func TestContractsRun(t *testing.T) {
+	src := `f divide(a, b)
+  requires b != 0, "b must not be zero"
+  ensures result * b == a
+{
+  return a / b
+}
+assert divide(6, 3) == 2
+print(divide(6, 3))
+print(divide(1, 0))
+print("done")`
+
+	// A failed check stops the program with the AY line that failed
+	out, err := runCompiled(t, compileSource(t, src))
+	exit, ok := err.(*exec.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want the run to fail", err)
+	}
+	if out != "2\n" {
+		t.Errorf("printed %q, want %q", out, "2\n")
+	}
+	if want := "Precondition failed at line 2: b must not be zero"; !strings.Contains(string(exit.Stderr), want) {
+		t.Errorf("got stderr %q, want it to contain %q", exit.Stderr, want)
+	}
+
+	// -release leaves every check out
+	out, err = runCompiled(t, compileSourceWith(t, src, CompileOptions{Release: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2\nInfinity\ndone\n"; out != want {
+		t.Errorf("with release printed %q, want %q", out, want)
+	}
+
+	for _, check := range []string{"assert 1 == 2", "f one() ensures result == 2 { return 1 }\none()"} {
+		if _, err := runCompiled(t, compileSource(t, check)); err == nil {
+			t.Errorf("%q ran without failing", check)
+		}
+		if _, err := runCompiled(t, compileSourceWith(t, check, CompileOptions{Release: true})); err != nil {
+			t.Errorf("%q failed with release: %v", check, err)
+		}
+	}
+}
+
+func TestNamedArgsRun(t *testing.T) {
+	src := `record Point(x, y)
+f greet(name, greeting) { return greeting + ", " + name }
+print(Point(y: 2, x: 1))
+print(greet("Ada", greeting: "Hi"))
+print(greet(greeting: "Hello", name: "Bob"))`
+	want := "Point(x: 1, y: 2)\nHi, Ada\nHello, Bob\n"
+	if got := runProgram(t, src); got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
+
+func TestChannelsAndSelectRun(t *testing.T) {
+	src := `f producer(jobs) {
+  for (l i = 0; i < 3; i++) {
+    send(jobs, i)
+    sleep(10)
+  }
+  closeChan(jobs)
+}
+f main() {
+  l jobs = chan()
+  spawn producer(jobs)
+  l job = recv(jobs)
+  while (job != undefined) {
+    print("got", job)
+    job = recv(jobs)
+  }
+  l inbox = chan(1)
+  l outbox = chan(1)
+  select {
+    l msg = recv(inbox) => print(msg)
+    send(outbox, "ping") => print("sent")
+    default => print("nothing ready")
+  }
+  send(inbox, "hello")
+  select {
+    l msg = recv(inbox) => print("received", msg)
+    default => print("nothing ready")
+  }
+  select {
+    l msg = recv(inbox) => print("received", msg)
+    default => print("nothing ready")
+  }
+}
+main()`
+	want := "got 0\ngot 1\ngot 2\nsent\nreceived hello\nnothing ready\n"
+	if got := runProgram(t, src); got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,310 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+)
+
+// blockingBuiltins are the runtime functions that wait on other tasks. Calls
+// to them, and to functions that make such calls, are awaited automatically.
+var blockingBuiltins = []string{"send", "recv", "sleep"}
+
+// parseSpawn parses spawn name(args), which runs the call as a separate task
+func (p *Parser) parseSpawn() *ASTNode {
+	spawnToken := p.consume() // consume 'spawn'
+
+	call := p.parseExpression()
+	if call == nil {
+		return nil
+	}
+	if call.Type != CallExpression || call.Left != nil {
+		p.addErrorAt(spawnToken, codeSpawnSyntax, fmt.Sprintf("'%s' needs a function call, like %s worker(ch)", spawnToken.Spelling(), spawnToken.Spelling()))
+		return nil
+	}
+	p.consumeOptionalSemicolon()
+
+	return &ASTNode{
+		Type:        SpawnStmt,
+		Initializer: call,
+		Span:        p.spanFrom(spawnToken.Pos()),
+	}
+}
+
+// parseSelect parses select statements, which wait for the first of several
+// channel operations:
+//
+//	select {
+//	    l msg = recv(inbox) => print(msg)
+//	    send(outbox, job) => print("sent")
+//	    default => print("nothing ready")
+//	}
+func (p *Parser) parseSelect() *ASTNode {
+	selectToken := p.consume() // consume 'select'
+
+	if !p.expectTokenVal("{") {
+		p.addError(codeSelectSyntax, fmt.Sprintf("Expected '{' after '%s'", selectToken.Spelling()))
+		return nil
+	}
+	p.consume() // consume '{'
+
+	var cases []ASTNode
+	hasDefault := false
+	for {
+		for p.expectToken(NewLine) || p.expectTokenVal(",") {
+			p.tokenizer.Next()
+		}
+		if p.expectTokenVal("}") || p.expectToken(EOF) {
+			break
+		}
+
+		caseToken := p.tokenizer.GetCurrentToken()
+		selectCase := p.parseSelectCase()
+		if selectCase == nil {
+			return nil
+		}
+		if selectCase.Initializer == nil {
+			if hasDefault {
+				p.addErrorAt(caseToken, codeSelectSyntax, fmt.Sprintf("'%s' can only have one default case", selectToken.Spelling()))
+			}
+			hasDefault = true
+		}
+		cases = append(cases, *selectCase)
+	}
+
+	if !p.expectTokenVal("}") {
+		p.addUnclosedError("}", fmt.Sprintf("Expected '}' to close '%s'", selectToken.Spelling()))
+		return nil
+	}
+	p.consume() // consume '}'
+
+	return &ASTNode{
+		Type: SelectStmt,
+		Body: cases,
+		Span: p.spanFrom(selectToken.Pos()),
+	}
+}
+
+// parseSelectCase parses [l name =] recv(ch) => body, send(ch, value) => body
+// or default => body. The channel operation is stored as a plain call
+// name(ch[, value]) in Initializer; default cases have none.
+func (p *Parser) parseSelectCase() *ASTNode {
+	node := &ASTNode{Type: SelectCase}
+	start := p.here()
+
+	if p.expectToken(Identifier) && p.tokenizer.GetCurrentToken().Value == "default" && p.expectPeekVal("=>") {
+		p.consume() // consume 'default'
+	} else {
+		if p.expectTokenVal("l") {
+			p.consume() // consume 'l'
+			if !p.expectToken(Identifier) || !p.expectPeekVal("=") {
+				p.addError(codeSelectSyntax, "Expected 'name =' before the received value")
+				return nil
+			}
+			node.Identifier = p.consume().Value
+			p.consume() // consume '='
+		}
+
+		opToken := p.tokenizer.GetCurrentToken()
+		op := p.parseOperand()
+		if op == nil {
+			return nil
+		}
+		if op.Type != CallExpression || (op.Identifier != "recv" && op.Identifier != "send") {
+			p.addErrorAt(opToken, codeSelectSyntax, "Expected recv(ch), send(ch, value) or default in select")
+			return nil
+		}
+		// ch.recv() and ch.send(value) are the same as recv(ch) and send(ch, value)
+		if op.Left != nil {
+			op = &ASTNode{Type: CallExpression, Identifier: op.Identifier, Args: append([]ASTNode{*op.Left}, op.Args...), Span: op.Span}
+		}
+		want := 1
+		if op.Identifier == "send" {
+			want = 2
+		}
+		if len(op.Args) != want {
+			p.addErrorAt(opToken, codeSelectSyntax, fmt.Sprintf("%s in select takes %d argument(s), got %d", opToken.Spelling(), want, len(op.Args)))
+			return nil
+		}
+		if node.Identifier != "" && op.Identifier == "send" {
+			p.addErrorAt(opToken, codeSelectSyntax, "Only a recv case can bind a value")
+		}
+		node.Initializer = op
+	}
+
+	if !p.expectTokenVal("=>") {
+		p.addError(codeSelectSyntax, "Expected '=>' after select case")
+		return nil
+	}
+	p.consume() // consume '=>'
+	p.skipNewLines()
+
+	if p.expectTokenVal("{") {
+		node.Consequent = p.parseBlockStatement()
+	} else if stmt := p.parseStatement(); stmt != nil {
+		node.Consequent = &ASTNode{Type: BlockStmt, Body: []ASTNode{*stmt}, Span: stmt.Span}
+	}
+	if node.Consequent == nil {
+		return nil
+	}
+	node.Span = p.spanFrom(start)
+	return node
+}
+
+// awaitBlockingCalls finds the functions that wait on channels, directly or
+// through other functions, and awaits every call to them. Functions holding
+// such calls compile to async functions.
+func (p *Parser) awaitBlockingCalls() {
+	functions := map[string]*ASTNode{}
+	for i := range p.Nodes {
+		collectFunctions(&p.Nodes[i], functions)
+	}
+
+	blocking := map[string]bool{}
+	for _, name := range blockingBuiltins {
+		if _, shadowed := functions[name]; !shadowed {
+			blocking[name] = true
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, fn := range functions {
+			if !blocking[name] && blocks(fn.Body, blocking) {
+				blocking[name] = true
+				changed = true
+			}
+		}
+	}
+
+	for i := range p.Nodes {
+		p.awaitCalls(&p.Nodes[i], blocking, 0)
+	}
+}
+
+// collectFunctions records every named function declared in node
+func collectFunctions(node *ASTNode, functions map[string]*ASTNode) {
+	switch {
+	case node.Type == FunctionDeclaration && node.Identifier != "":
+		functions[node.Identifier] = node
+	case node.Type == VariableDeclaration && node.Initializer != nil && node.Initializer.Type == FunctionDeclaration:
+		functions[node.Identifier] = node.Initializer
+	}
+	for _, child := range node.children() {
+		collectFunctions(child, functions)
+	}
+}
+
+// blockingCallee returns the name of the function node calls, if that
+// function blocks
+func blockingCallee(node ASTNode, blocking map[string]bool) (string, bool) {
+	var name string
+	switch node.Type {
+	case CallExpression:
+		// Method calls only reach a plain function when they are built-ins
+		if node.Left != nil && (!slices.Contains(blockingBuiltins, node.Identifier) ||
+			(node.Left.Type == IdentifierD && slices.Contains(hostObjects, node.Left.Value))) {
+			return "", false
+		}
+		name = node.Identifier
+	case PipeExpression:
+		switch node.Right.Type {
+		case IdentifierD:
+			name = node.Right.Value
+		case CallExpression, MemberExpression:
+			name = node.Right.Identifier
+		}
+	}
+	return name, name != "" && blocking[name]
+}
+
+// blocks reports whether nodes wait on anything, not counting nested
+// functions or spawned calls
+func blocks(nodes []ASTNode, blocking map[string]bool) bool {
+	for i := range nodes {
+		node := &nodes[i]
+		if _, ok := blockingCallee(*node, blocking); ok || node.Type == SelectStmt {
+			return true
+		}
+		switch node.Type {
+		case FunctionDeclaration:
+			continue
+		case SpawnStmt:
+			if blocks(node.Initializer.Args, blocking) {
+				return true
+			}
+			continue
+		}
+		for _, child := range node.children() {
+			if blocks([]ASTNode{*child}, blocking) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// awaitCalls wraps blocking calls under node in await. depth counts the
+// functions node is inside; blocking at the top level is an error.
+func (p *Parser) awaitCalls(node *ASTNode, blocking map[string]bool, depth int) {
+	switch node.Type {
+	case FunctionDeclaration:
+		depth++
+	case SpawnStmt:
+		// The spawned call runs as its own task, only its arguments are awaited
+		for i := range node.Initializer.Args {
+			p.awaitCalls(&node.Initializer.Args[i], blocking, depth)
+		}
+		return
+	case AwaitExpression:
+		// Already awaited by hand
+		for _, child := range node.Left.children() {
+			p.awaitCalls(child, blocking, depth)
+		}
+		return
+	case SelectStmt:
+		if depth == 0 {
+			p.addStandaloneErrorAt(spanToken(Keyword, "select", node.Span), codeOutsideFunction,
+				fmt.Sprintf("'%s' waits on channels, so it can only be used inside a function (start one with %s)", spell("select"), spell("spawn")))
+		}
+		for i := range node.Body {
+			selectCase := &node.Body[i]
+			if selectCase.Initializer != nil {
+				for j := range selectCase.Initializer.Args {
+					p.awaitCalls(&selectCase.Initializer.Args[j], blocking, depth)
+				}
+			}
+			p.awaitCalls(selectCase.Consequent, blocking, depth)
+		}
+		return
+	}
+
+	name, ok := blockingCallee(*node, blocking)
+	if !ok {
+		for _, child := range node.children() {
+			p.awaitCalls(child, blocking, depth)
+		}
+		return
+	}
+
+	// Top-level calls to AY functions just start them; channel operations
+	// need a function to wait in
+	if depth == 0 && slices.Contains(blockingBuiltins, name) {
+		p.addStandaloneErrorAt(spanToken(Identifier, name, node.Span), codeOutsideFunction,
+			fmt.Sprintf("'%s' waits on other tasks, so it can only be used inside a function (start one with %s)", spell(name), spell("spawn")))
+		return
+	}
+
+	if node.Type == PipeExpression {
+		p.awaitCalls(node.Left, blocking, depth)
+		for _, child := range node.Right.children() {
+			p.awaitCalls(child, blocking, depth)
+		}
+	} else {
+		for _, child := range node.children() {
+			p.awaitCalls(child, blocking, depth)
+		}
+	}
+	if depth > 0 {
+		inner := *node
+		*node = ASTNode{Type: AwaitExpression, Left: &inner, Span: inner.Span}
+	}
+}
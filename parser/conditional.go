@@ -0,0 +1,185 @@
+package parser
+
+import "fmt"
+
+// condFrame tracks one #if ... #elif ... #else ... #end block during preprocessing
+type condFrame struct {
+	open    Token // the '#' that opened the block, for error messages
+	parent  bool  // whether the enclosing code is being kept
+	active  bool  // whether the current branch is being kept
+	taken   bool  // whether any branch has been kept so far
+	sawElse bool
+}
+
+// condActive reports whether tokens at the current nesting level are kept
+func condActive(conds []condFrame) bool {
+	return len(conds) == 0 || conds[len(conds)-1].active
+}
+
+// directive applies a #if, #elif, #else or #end line to the block stack
+func (p *Parser) directive(line []Token, conds []condFrame) []condFrame {
+	if len(line) < 2 {
+		p.addStandaloneErrorAt(line[0], codeDirectiveSyntax, "Expected directive name after '#'")
+		return conds
+	}
+	name := line[1].Value
+
+	switch name {
+	case "if":
+		frame := condFrame{open: line[0], parent: condActive(conds)}
+		if frame.parent {
+			frame.active = p.evalCondition(line[0], line[2:])
+		}
+		// A block inside dropped code never keeps any branch
+		frame.taken = frame.active || !frame.parent
+		return append(conds, frame)
+	case "elif", "else":
+		if len(conds) == 0 {
+			p.addStandaloneErrorAt(line[0], codeUnbalancedIf, fmt.Sprintf("#%s without matching #if", name))
+			return conds
+		}
+		frame := &conds[len(conds)-1]
+		if frame.sawElse {
+			p.addStandaloneErrorAt(line[0], codeUnbalancedIf, fmt.Sprintf("#%s after #else", name))
+			return conds
+		}
+		if name == "else" {
+			frame.sawElse = true
+			frame.active = !frame.taken
+		} else {
+			frame.active = !frame.taken && p.evalCondition(line[0], line[2:])
+		}
+		frame.taken = frame.taken || frame.active
+		return conds
+	case "end":
+		if len(conds) == 0 {
+			p.addStandaloneErrorAt(line[0], codeUnbalancedIf, "#end without matching #if")
+			return conds
+		}
+		return conds[:len(conds)-1]
+	}
+
+	p.addStandaloneErrorAt(line[1], codeDirectiveSyntax, fmt.Sprintf("Unknown directive '#%s'", name)).
+		withNote("the directives are #if, #elif, #else and #end")
+	return conds
+}
+
+// condParser evaluates the condition of an #if or #elif line. Conditions are
+// built from define names, def(NAME), literals, ==, !=, !, && and ||.
+type condParser struct {
+	p      *Parser
+	tokens []Token
+	pos    int
+	failed bool
+}
+
+// evalCondition evaluates a directive condition against the current defines
+func (p *Parser) evalCondition(at Token, tokens []Token) bool {
+	if len(tokens) == 0 {
+		p.addStandaloneErrorAt(at, codeDirectiveSyntax, "Expected condition after directive")
+		return false
+	}
+	c := &condParser{p: p, tokens: tokens}
+	result := c.parseOr()
+	if c.failed || c.pos < len(c.tokens) {
+		p.addStandaloneErrorAt(at, codeDirectiveSyntax, fmt.Sprintf("Invalid directive condition: %s", tokensText(tokens)))
+		return false
+	}
+	return result
+}
+
+func (c *condParser) peek() string {
+	if c.pos < len(c.tokens) {
+		return c.tokens[c.pos].Value
+	}
+	return ""
+}
+
+func (c *condParser) parseOr() bool {
+	result := c.parseAnd()
+	for c.peek() == "||" {
+		c.pos++
+		right := c.parseAnd()
+		result = result || right
+	}
+	return result
+}
+
+func (c *condParser) parseAnd() bool {
+	result := c.parseUnary()
+	for c.peek() == "&&" {
+		c.pos++
+		right := c.parseUnary()
+		result = result && right
+	}
+	return result
+}
+
+func (c *condParser) parseUnary() bool {
+	switch c.peek() {
+	case "!":
+		c.pos++
+		return !c.parseUnary()
+	case "(":
+		c.pos++
+		result := c.parseOr()
+		if c.peek() != ")" {
+			c.failed = true
+			return false
+		}
+		c.pos++
+		return result
+	case "def":
+		// def(NAME) is true when NAME is defined at all
+		if c.pos+3 < len(c.tokens) && c.tokens[c.pos+1].Value == "(" &&
+			c.tokens[c.pos+2].Type == Identifier && c.tokens[c.pos+3].Value == ")" {
+			_, defined := c.p.defines[c.tokens[c.pos+2].Value]
+			c.pos += 4
+			return defined
+		}
+		c.failed = true
+		return false
+	}
+
+	left, defined := c.parseOperand()
+	if op := c.peek(); op == "==" || op == "!=" {
+		c.pos++
+		right, _ := c.parseOperand()
+		return (left == right) == (op == "==")
+	}
+	return defined && left != "" && left != "false" && left != "0"
+}
+
+// parseOperand returns the text value of a define name or literal and
+// whether it has a value at all
+func (c *condParser) parseOperand() (string, bool) {
+	if c.pos >= len(c.tokens) {
+		c.failed = true
+		return "", false
+	}
+	tk := c.tokens[c.pos]
+	c.pos++
+	switch tk.Type {
+	case Identifier:
+		m, exists := c.p.defines[tk.Value]
+		if !exists {
+			return "", false
+		}
+		if len(m.body) == 1 {
+			return literalText(m.body[0]), true
+		}
+		return tokensText(m.body), true
+	case Literal, StringLiteral, Keyword:
+		return literalText(tk), true
+	}
+	c.failed = true
+	return "", false
+}
+
+// literalText returns a token's value without the opening quote string literals carry
+func literalText(tk Token) string {
+	if tk.Type == StringLiteral && tk.Value != "" {
+		return tk.Value[1:]
+	}
+	return tk.Value
+}
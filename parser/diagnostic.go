@@ -0,0 +1,96 @@
+package parser
+
+import "encoding/json"
+
+// Severity says whether a diagnostic stops compilation
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Diagnostic is an error or warning about the source
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	// Code names the kind of problem, such as AY0013. It never changes
+	// meaning, so tools can rely on it where messages may be reworded.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Span    Span   `json:"span"`
+	// Label says what is wrong at Span, under the source it points at
+	Label string `json:"label,omitempty"`
+	// Related points out other places that explain the problem, such as
+	// where a bracket left open was opened
+	Related []Label  `json:"related,omitempty"`
+	Notes   []string `json:"notes,omitempty"`
+	Fix     *Fix     `json:"fix,omitempty"`
+}
+
+// Label is a message about a stretch of source
+type Label struct {
+	Span    Span   `json:"span"`
+	Message string `json:"message"`
+}
+
+// Fix is a change to the source that would resolve a diagnostic: the text in
+// Span is replaced with Replacement. An empty span inserts it.
+type Fix struct {
+	Message     string `json:"message"`
+	Span        Span   `json:"span"`
+	Replacement string `json:"replacement"`
+}
+
+// withNote adds a note to d. Like the other with methods it does nothing to
+// a nil d, the result of an error left out, so calls can be chained on
+// addError directly.
+func (d *Diagnostic) withNote(note string) *Diagnostic {
+	if d != nil {
+		d.Notes = append(d.Notes, note)
+	}
+	return d
+}
+
+// withLabel sets the label of the diagnostic's own span
+func (d *Diagnostic) withLabel(label string) *Diagnostic {
+	if d != nil {
+		d.Label = label
+	}
+	return d
+}
+
+// withRelated points out another place in the source
+func (d *Diagnostic) withRelated(span Span, message string) *Diagnostic {
+	if d != nil {
+		d.Related = append(d.Related, Label{Span: span, Message: message})
+	}
+	return d
+}
+
+// withFix suggests inserting text at pos
+func (d *Diagnostic) withFix(message string, pos Pos, text string) *Diagnostic {
+	if d != nil {
+		d.Fix = &Fix{Message: message, Span: Span{Start: pos, End: pos}, Replacement: text}
+	}
+	return d
+}
+
+// diagnosticAt returns a diagnostic covering token at
+func diagnosticAt(severity Severity, at Token, code, message string) Diagnostic {
+	span := Span{Start: at.Pos(), End: at.End}
+	if span.End.Offset < span.Start.Offset {
+		span.End = span.Start
+	}
+	return Diagnostic{Severity: severity, Code: code, Message: message, Span: span}
+}
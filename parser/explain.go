@@ -0,0 +1,33 @@
+package parser
+
+import (
+	_ "embed"
+	"strings"
+)
+
+// The catalog of diagnostic codes: a "## CODE: Title" section for each, with
+// a long explanation and examples
+//
+//go:embed codes.md
+var catalog string
+
+// explanations maps each code to its section of the catalog
+var explanations = parseCatalog(catalog)
+
+// parseCatalog splits the catalog into its sections, keyed by code
+func parseCatalog(catalog string) map[string]string {
+	sections := strings.Split(catalog, "\n## ")
+	explanations := make(map[string]string, len(sections))
+	for _, section := range sections[1:] {
+		code, _, _ := strings.Cut(section, ":")
+		explanations[code] = strings.TrimSpace(section) + "\n"
+	}
+	return explanations
+}
+
+// Explain returns the long explanation of a diagnostic code such as AY0012,
+// with examples of code that causes it and how to fix it
+func Explain(code string) (string, bool) {
+	explanation, ok := explanations[strings.ToUpper(code)]
+	return explanation, ok
+}
@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// reportedCodes returns the diagnostic codes the package reports: the values
+// of the code constants in codes.go that its other files refer to
+func reportedCodes(t *testing.T) []string {
+	t.Helper()
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := pkgs["parser"].Files
+
+	values := map[string]string{}
+	for _, decl := range files["codes.go"].Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.ValueSpec)
+			for i, name := range spec.Names {
+				lit, ok := spec.Values[i].(*ast.BasicLit)
+				if !ok || !strings.HasPrefix(name.Name, "code") {
+					continue
+				}
+				values[name.Name], _ = strconv.Unquote(lit.Value)
+			}
+		}
+	}
+	if len(values) == 0 {
+		t.Fatal("no code constants in codes.go")
+	}
+
+	used := map[string]bool{}
+	for name, file := range files {
+		if name == "codes.go" {
+			continue
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				if code, ok := values[id.Name]; ok {
+					used[code] = true
+				}
+			}
+			return true
+		})
+	}
+	return slices.Sorted(maps.Keys(used))
+}
+
+func TestEveryCodeIsExplained(t *testing.T) {
+	codes := reportedCodes(t)
+	for _, code := range codes {
+		if _, ok := Explain(code); !ok {
+			t.Errorf("diagnostic code %s has no entry in codes.md", code)
+		}
+	}
+	for code := range explanations {
+		if !slices.Contains(codes, code) {
+			t.Errorf("codes.md explains %s, which is never reported", code)
+		}
+	}
+}
+
+func TestExplainIgnoresCase(t *testing.T) {
+	want, ok := Explain("AY0013")
+	if !ok || !strings.HasPrefix(want, "AY0013: ") {
+		t.Fatalf("Explain(AY0013) = %q, %v", want, ok)
+	}
+	if got, _ := Explain("ay0013"); got != want {
+		t.Errorf("Explain(ay0013) differs from Explain(AY0013)")
+	}
+	if _, ok := Explain("AY9999"); ok {
+		t.Errorf("Explain(AY9999) found an entry")
+	}
+}
@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// KeywordPack gives AY keywords and built-in function names another spelling,
+// so a project can be written in another human language or a house dialect.
+// Both maps go from the AY name to the pack's spelling, e.g. {"if": "si"}.
+// Pack spellings are accepted alongside the standard ones.
+type KeywordPack struct {
+	Name     string            `json:"name"`
+	Keywords map[string]string `json:"keywords"`
+	Builtins map[string]string `json:"builtins"`
+}
+
+// Active keyword pack lookups, from pack spelling to AY name and back
+var (
+	packKeywords = map[string]string{}
+	packBuiltins = map[string]string{}
+	packSpelling = map[string]string{}
+)
+
+// LoadKeywordPack reads a keyword pack from a JSON file
+func LoadKeywordPack(path string) (*KeywordPack, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pack KeywordPack
+	if err := json.Unmarshal(data, &pack); err != nil {
+		return nil, fmt.Errorf("invalid keyword pack %s: %v", path, err)
+	}
+	return &pack, nil
+}
+
+// UseKeywordPack makes pack the active keyword pack for Tokenize and parser
+// diagnostics. Passing nil goes back to the standard spellings.
+func UseKeywordPack(pack *KeywordPack) error {
+	keywords := map[string]string{}
+	builtins := map[string]string{}
+	spelling := map[string]string{}
+
+	if pack != nil {
+		for keyword, word := range pack.Keywords {
+			if !isKeyword(keyword) {
+				return fmt.Errorf("keyword pack %q: '%s' is not an AY keyword", pack.Name, keyword)
+			}
+			if err := checkPackWord(pack, word, keywords, builtins); err != nil {
+				return err
+			}
+			keywords[word] = keyword
+			spelling[keyword] = word
+		}
+		for builtin, word := range pack.Builtins {
+			// Built-ins can only be checked once LoadBuiltins has run
+			if !isIdentifier(builtin) || (len(Builtins) > 0 && !isBuiltin(builtin)) {
+				return fmt.Errorf("keyword pack %q: '%s' is not a built-in name", pack.Name, builtin)
+			}
+			if err := checkPackWord(pack, word, keywords, builtins); err != nil {
+				return err
+			}
+			builtins[word] = builtin
+			spelling[builtin] = word
+		}
+	}
+
+	packKeywords, packBuiltins, packSpelling = keywords, builtins, spelling
+	return nil
+}
+
+// checkPackWord makes sure a pack spelling is a usable, unambiguous word
+func checkPackWord(pack *KeywordPack, word string, keywords, builtins map[string]string) error {
+	if !isIdentifier(word) {
+		return fmt.Errorf("keyword pack %q: '%s' is not a valid identifier", pack.Name, word)
+	}
+	if isKeyword(word) {
+		return fmt.Errorf("keyword pack %q: '%s' is already an AY keyword", pack.Name, word)
+	}
+	if _, taken := keywords[word]; taken {
+		return fmt.Errorf("keyword pack %q: '%s' is used more than once", pack.Name, word)
+	}
+	if _, taken := builtins[word]; taken {
+		return fmt.Errorf("keyword pack %q: '%s' is used more than once", pack.Name, word)
+	}
+	return nil
+}
+
+// spell returns the active pack's spelling of an AY keyword or built-in name
+func spell(name string) string {
+	if word, ok := packSpelling[name]; ok {
+		return word
+	}
+	return name
+}
@@ -0,0 +1,507 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// lexer turns source text into tokens in a single pass. It reads the input a
+// line at a time and only lexes further when the tokens it has are used up.
+// It keeps the token being built in cur and gives each token its position as
+// it is emitted. Whitespace and comments are tracked for positions but not
+// returned, unless trivia is set: then they are kept as the Leading of the
+// next token. Columns count runes; Offset counts bytes.
+type lexer struct {
+	rd    *bufio.Reader
+	lines *sourceLines
+	buf   []byte  // current source line, with its line break
+	pos   int     // next character in buf
+	queue []Token // tokens lexed but not yet returned
+	qpos  int     // next token of queue to return
+	done  bool    // the input is used up and EOF has been queued
+	err   error   // error reading the input, if any
+	cur   []byte  // text of the token being built
+	typ   int     // type of the token being built
+	sOpen bool    // inside a string literal
+	line  int
+	col   int
+	off   int
+
+	trivia  bool    // keep the source text of tokens and what's between them
+	leading []Token // trivia waiting for the next token
+
+	// onError reports malformed input, such as invalid UTF-8. It may be nil.
+	onError func(at Token, code, message string) *Diagnostic
+}
+
+// isIdentStart reports whether c can start an identifier: ASCII letters, '_',
+// '@' and any Unicode letter
+func isIdentStart(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '@' ||
+		c >= utf8.RuneSelf && unicode.IsLetter(c)
+}
+
+// isIdentChar reports whether c can continue an identifier. Besides what can
+// start one, that is digits and combining marks from any script.
+func isIdentChar(c rune) bool {
+	return isIdentStart(c) || isDigit(c) ||
+		c >= utf8.RuneSelf && (unicode.IsDigit(c) || unicode.In(c, unicode.Mn, unicode.Mc))
+}
+
+// isDigit reports whether c is an ASCII digit. Numbers are only written with these.
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSpace(c rune) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+func isOpChar(c rune) bool {
+	return c < utf8.RuneSelf && strings.IndexByte("+*/%=<>&|!?^-", byte(c)) >= 0
+}
+
+func isPunct(c rune) bool {
+	return c < utf8.RuneSelf && strings.IndexByte("(){}[]:;,.#", byte(c)) >= 0
+}
+
+// isOpPair reports whether a and b together make a two-character operator
+func isOpPair(a, b byte) bool {
+	switch string([]byte{a, b}) {
+	case "==", "!=", "<=", ">=", "&&", "||", "++", "--", "+=", "-=", "*=", "/=", "%=", "|>", "=>":
+		return true
+	}
+	return false
+}
+
+// containsByte reports whether any byte of s satisfies class. Classes used
+// with it only hold ASCII characters, so s needn't be split into runes.
+func containsByte(s []byte, class func(rune) bool) bool {
+	for _, c := range s {
+		if class(rune(c)) {
+			return true
+		}
+	}
+	return false
+}
+
+// newLexer returns a lexer reading from r
+func newLexer(r io.Reader) *lexer {
+	return &lexer{rd: bufio.NewReader(r), lines: newSourceLines(r), line: 1, col: 1}
+}
+
+// Tokenize splits source text into tokens, ending with an EOF token
+func Tokenize(src string) []Token {
+	l := newLexer(strings.NewReader(src))
+	var tokens []Token
+	for {
+		tok := l.next()
+		tokens = append(tokens, tok)
+		if tok.Type == EOF {
+			return tokens
+		}
+	}
+}
+
+// next returns the next token. Once the input is used up it keeps returning EOF.
+func (l *lexer) next() Token {
+	for l.qpos == len(l.queue) {
+		if l.done {
+			end := Pos{Line: l.line, Col: l.col, Offset: l.off}
+			return Token{Type: EOF, Value: "", Line: end.Line, Col: end.Col, Offset: end.Offset, End: end}
+		}
+		l.queue, l.qpos = l.queue[:0], 0
+		l.step()
+	}
+	tok := l.queue[l.qpos]
+	l.qpos++
+	return tok
+}
+
+// readLine loads the next source line into buf. It reports false at the end
+// of the input.
+func (l *lexer) readLine() bool {
+	l.buf, l.pos = l.buf[:0], 0
+	for {
+		chunk, err := l.rd.ReadSlice('\n')
+		l.buf = append(l.buf, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && err != io.EOF {
+			l.err = err
+		}
+		break
+	}
+	if len(l.buf) == 0 {
+		return false
+	}
+	l.lines.add(l.buf)
+	return true
+}
+
+// step lexes one character, reading a new line when the current one is done
+func (l *lexer) step() {
+	if l.pos >= len(l.buf) && !l.readLine() {
+		l.finish()
+		return
+	}
+	src := l.buf
+	i := l.pos
+	c, width := utf8.DecodeRune(src[i:])
+	// A line ends with its line break, so only the last line of the input
+	// has a character without anything after it
+	hasNext := i+width < len(src)
+	var next rune
+	if hasNext {
+		next, _ = utf8.DecodeRune(src[i+width:])
+	}
+
+	if c == utf8.RuneError && width == 1 {
+		l.invalidUTF8(src[i])
+		if !l.sOpen && l.typ != SingleLineComment && l.typ != MultiLineComment {
+			l.flush()
+			l.skip(src[i : i+1])
+			l.pos++
+			return
+		}
+	}
+
+	// Comments: /* ... */ runs to the closing */, // to the end of the line
+	if hasNext && c == '/' && next == '*' && l.typ != SingleLineComment && l.typ != MultiLineComment && !l.sOpen {
+		l.flush()
+		l.typ = MultiLineComment
+		l.cur = append(l.cur[:0], "/*"...)
+		l.pos += 2
+		return
+	}
+	if hasNext && c == '*' && next == '/' && l.typ == MultiLineComment && !l.sOpen {
+		l.emit(Token{Type: MultiLineComment, Value: string(l.cur) + "*/"})
+		l.reset(Identifier)
+		l.pos += 2
+		return
+	}
+
+	// New lines end single line comments, and strings left open
+	if l.typ != MultiLineComment && (c == '\n' || hasNext && c == '\r' && next == '\n') {
+		if l.sOpen {
+			l.endOpenString()
+		}
+		l.flush()
+		newline := "\n"
+		if c == '\r' {
+			newline = "\r\n"
+		}
+		l.emit(Token{Type: NewLine, Value: newline})
+		l.reset(Identifier)
+		l.pos += len(newline)
+		return
+	}
+
+	// A quote opens a string, or closes one opened with the same quote.
+	// String values keep their opening quote.
+	if (c == '"' || c == '\'') && l.typ != SingleLineComment && l.typ != MultiLineComment {
+		if !l.sOpen {
+			l.flush()
+			l.typ = StringLiteral
+			l.sOpen = true
+			l.cur = append(l.cur[:0], byte(c), byte(c))
+			l.pos++
+			return
+		}
+		if len(l.cur) > 0 && rune(l.cur[0]) == c {
+			l.emit(Token{Type: l.typ, Value: string(l.cur[1:])})
+			// The closing quote isn't part of the value, but is part of the token
+			str := &l.queue[len(l.queue)-1]
+			l.line, l.col, l.off = advance(l.line, l.col, l.off, string(c))
+			str.End = Pos{Line: l.line, Col: l.col, Offset: l.off}
+			if l.trivia {
+				str.Text += string(c)
+			}
+			l.sOpen = false
+			l.reset(Identifier)
+			l.pos++
+			return
+		}
+	}
+
+	// Everything inside strings and comments is kept as is
+	if l.sOpen || l.typ == SingleLineComment || l.typ == MultiLineComment {
+		l.cur = append(l.cur, src[i:i+width]...)
+		l.pos += width
+		return
+	}
+
+	// A number left open by a '.' ends at anything that doesn't continue it
+	if l.typ == Literal && len(l.cur) > 0 && !isDigit(c) && (c != '.' || strings.Contains(string(l.cur), ".")) {
+		l.emitCur()
+	}
+
+	switch {
+	case isIdentStart(c), !isDigit(c) && isIdentChar(c) && l.typ == Identifier && len(l.cur) > 0:
+		if l.typ != Identifier {
+			l.typ = Identifier
+			l.cur = l.cur[:0]
+		}
+		l.cur = append(l.cur, src[i:i+width]...)
+		if hasNext && !isIdentChar(next) {
+			l.emitWord()
+		}
+
+	case isSpace(c):
+		if len(l.cur) == 0 || !containsByte(l.cur, isSpace) {
+			l.cur = l.cur[:0]
+		}
+		l.typ = Whitespace
+		l.cur = append(l.cur, byte(c))
+		if hasNext && !isSpace(next) {
+			l.emitCur()
+		}
+
+	case c == '/' && hasNext && next == '/':
+		l.flush()
+		l.typ = SingleLineComment
+		l.cur = append(l.cur[:0], byte(c))
+
+	case isOpChar(c):
+		// Operator characters are collected into a run, then split into the
+		// operators they make up
+		if l.typ != Operator || !containsByte(l.cur, isOpChar) {
+			l.cur = l.cur[:0]
+		}
+		l.typ = Operator
+		l.cur = append(l.cur, byte(c))
+		if hasNext && !isOpChar(next) {
+			l.emitOperators()
+		}
+
+	case isDigit(c):
+		// Digits continue an identifier, or a number otherwise
+		if l.typ == Identifier {
+			l.cur = append(l.cur, byte(c))
+			if hasNext && !isIdentChar(next) {
+				l.emitWord()
+			}
+			break
+		}
+		l.typ = Literal
+		if len(l.cur) == 0 || !containsByte(l.cur, isDigit) && l.cur[len(l.cur)-1] != '.' {
+			l.cur = l.cur[:0]
+		}
+		l.cur = append(l.cur, byte(c))
+		if hasNext && !isDigit(next) && next != '.' {
+			l.emitCur()
+		}
+
+	case isPunct(c):
+		// A '.' inside a number is its decimal point
+		if l.typ == Literal && c == '.' && len(l.cur) > 0 && !strings.Contains(string(l.cur), ".") {
+			l.cur = append(l.cur, byte(c))
+			break
+		}
+		l.typ = Punctuation
+		l.emit(Token{Type: Punctuation, Value: string(c)})
+		l.cur = l.cur[:0]
+
+	default:
+		// A byte order mark may start the file. Any other character AY has no
+		// use for is reported and kept as an Unknown token, which the parser
+		// passes over without reporting it again.
+		if c == '\uFEFF' && l.off == 0 {
+			l.skip(src[i : i+width])
+			break
+		}
+		l.typ = Unknown
+		tok := l.emit(Token{Type: Unknown, Value: string(c)})
+		l.report(tok, codeUnexpectedCharacter, fmt.Sprintf("Unexpected character '%c'", c))
+		l.cur = l.cur[:0]
+	}
+	l.pos += width
+}
+
+// finish emits any token still being built, then EOF
+func (l *lexer) finish() {
+	if l.sOpen {
+		l.endOpenString()
+	}
+	if l.typ == MultiLineComment && len(l.cur) > 0 {
+		l.report(Token{Type: MultiLineComment, Value: "/*"}, codeUnterminatedComment, "Unterminated comment, expected */")
+	}
+	l.flush()
+	l.emit(Token{Type: EOF, Value: ""})
+	l.done = true
+}
+
+// emitOperators emits the run of operator characters being built as the
+// operators it is made of. A run that isn't, such as === or <=>, is emitted
+// whole as an Unknown token, which emit reports.
+func (l *lexer) emitOperators() {
+	if ops := splitOperators(string(l.cur)); ops != nil {
+		for _, op := range ops {
+			l.emit(Token{Type: Operator, Value: op})
+		}
+	} else {
+		tok := l.emit(Token{Type: Unknown, Value: string(l.cur)})
+		l.report(tok, codeUnknownOperator, fmt.Sprintf("Unknown operator '%s'", tok.Value))
+	}
+	l.cur = l.cur[:0]
+}
+
+// splitOperators splits a run of operator characters into operators, taking
+// two-character ones first. It returns nil unless every operator after the
+// first can follow the one before it: a prefix operator like the - of a=-1,
+// anything after a postfix ++, -- or ?, or the > of a def's ->.
+func splitOperators(run string) []string {
+	var ops []string
+	for i := 0; i < len(run); {
+		n := 1
+		if i+1 < len(run) && isOpPair(run[i], run[i+1]) {
+			n = 2
+		}
+		op := run[i : i+n]
+		if n == 1 && strings.IndexByte("+-*/%=<>!?", op[0]) < 0 {
+			return nil
+		}
+		if len(ops) > 0 {
+			prev := ops[len(ops)-1]
+			prefix := slices.Contains([]string{"!", "-", "+", "++", "--"}, op)
+			postfix := slices.Contains([]string{"++", "--", "?"}, prev)
+			if !prefix && !postfix && !(prev == "-" && op == ">") {
+				return nil
+			}
+		}
+		ops = append(ops, op)
+		i += n
+	}
+	return ops
+}
+
+// flush emits the token being built, if there is one
+func (l *lexer) flush() {
+	if len(l.cur) == 0 {
+		return
+	}
+	switch l.typ {
+	case Identifier:
+		l.emitWord()
+	case Operator:
+		l.emitOperators()
+	default:
+		l.emitCur()
+	}
+}
+
+// reset starts a new, empty token of type typ
+func (l *lexer) reset(typ int) {
+	l.cur = l.cur[:0]
+	l.typ = typ
+}
+
+// emitCur emits the token being built with its current type
+func (l *lexer) emitCur() {
+	l.emit(Token{Type: l.typ, Value: string(l.cur)})
+	l.cur = l.cur[:0]
+}
+
+// emitWord emits the identifier being built as a keyword or identifier
+func (l *lexer) emitWord() {
+	l.emit(wordToken(string(l.cur)))
+	l.cur = l.cur[:0]
+}
+
+// emit places tok after the tokens before it and keeps it unless it is
+// whitespace or a comment, returning it with its position
+func (l *lexer) emit(tok Token) Token {
+	tok.Line, tok.Col, tok.Offset = l.line, l.col, l.off
+	l.line, l.col, l.off = advance(l.line, l.col, l.off, tok.Spelling())
+	tok.End = Pos{Line: l.line, Col: l.col, Offset: l.off}
+	if l.trivia {
+		tok.Text = tok.Spelling()
+	}
+
+	switch tok.Type {
+	case Whitespace, SingleLineComment, MultiLineComment:
+		if l.trivia {
+			l.leading = append(l.leading, tok)
+		}
+		return tok
+	}
+	if l.trivia {
+		tok.Leading, l.leading = l.leading, nil
+	}
+	l.queue = append(l.queue, tok)
+	return tok
+}
+
+// endOpenString ends the string being built where it stands, reporting the
+// missing closing quote
+func (l *lexer) endOpenString() {
+	quote := l.cur[0]
+	// Drop the copy of the opening quote kept for matching the closing one
+	l.cur = append(l.cur[:0], l.cur[1:]...)
+	l.report(Token{Type: StringLiteral, Value: string(l.cur)}, codeUnterminatedString, fmt.Sprintf("Unterminated string literal, expected closing %c", quote)).
+		withFix("close the string", l.endOf(string(l.cur)), string(quote))
+	l.sOpen = false
+}
+
+// report passes a problem with the source to onError. Tokens not emitted yet
+// are placed at the current position.
+func (l *lexer) report(at Token, code, message string) *Diagnostic {
+	if l.onError == nil {
+		return nil
+	}
+	if at.Line == 0 {
+		at.Line, at.Col, at.Offset = l.line, l.col, l.off
+		at.End = l.endOf(at.Spelling())
+	}
+	return l.onError(at, code, message)
+}
+
+// skip moves past source text that isn't part of any token. With trivia it
+// is kept as an Unknown token in the next token's Leading.
+func (l *lexer) skip(text []byte) {
+	start := Pos{Line: l.line, Col: l.col, Offset: l.off}
+	l.line, l.col, l.off = advance(l.line, l.col, l.off, string(text))
+	if l.trivia {
+		l.leading = append(l.leading, Token{Type: Unknown, Value: string(text), Line: start.Line, Col: start.Col,
+			Offset: start.Offset, End: Pos{Line: l.line, Col: l.col, Offset: l.off}, Text: string(text)})
+	}
+}
+
+// endOf returns where text would end if it started at the current position
+func (l *lexer) endOf(text string) Pos {
+	line, col, off := advance(l.line, l.col, l.off, text)
+	return Pos{Line: line, Col: col, Offset: off}
+}
+
+// advance returns the position after text, when text starts at line, col and
+// byte offset off
+func advance(line, col, off int, text string) (int, int, int) {
+	off += len(text)
+	if last := strings.LastIndexByte(text, '\n'); last >= 0 {
+		return line + strings.Count(text, "\n"), utf8.RuneCountInString(text[last:]), off
+	}
+	return line, col + utf8.RuneCountInString(text), off
+}
+
+// invalidUTF8 reports byte c of the current line, which isn't valid UTF-8
+func (l *lexer) invalidUTF8(c byte) {
+	if l.onError == nil {
+		return
+	}
+	// The byte comes after the text of the token being built. Strings hold
+	// their opening quote twice, so don't count it twice.
+	text := string(l.cur)
+	if l.sOpen && len(text) > 0 {
+		text = text[1:]
+	}
+	at := Token{Type: Unknown, Value: fmt.Sprintf("\\x%02X", c)}
+	at.Line, at.Col, at.Offset = advance(l.line, l.col, l.off, text)
+	at.End = Pos{Line: at.Line, Col: at.Col + 1, Offset: at.Offset + 1}
+	l.onError(at, codeInvalidUTF8, fmt.Sprintf("Invalid UTF-8 byte 0x%02X; source files must be UTF-8", c))
+}
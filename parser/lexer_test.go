@@ -0,0 +1,235 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// formatTokens writes one token per line as line:col, byte offset, type and
+// value, the format of the .tokens files in testdata/lexer
+func formatTokens(tokens []Token) string {
+	var b strings.Builder
+	for _, tk := range tokens {
+		fmt.Fprintf(&b, "%d:%d\t%d\t%d\t%q\n", tk.Line, tk.Col, tk.Offset, tk.Type, tk.Value)
+	}
+	return b.String()
+}
+
+// oldTokens formats the tokens regexTokenize gives for src, each placed
+// where its text is in the source, past the whitespace and comments it left
+// out
+func oldTokens(src string) string {
+	pos, line, lineStart := 0, 1, 0
+	advance := func(n int) {
+		for i := pos; i < pos+n; i++ {
+			if src[i] == '\n' {
+				line, lineStart = line+1, i+1
+			}
+		}
+		pos += n
+	}
+	var tokens []Token
+	for _, tk := range regexTokenize(src) {
+		for pos < len(src) {
+			if src[pos] == ' ' || src[pos] == '\t' || src[pos] == '\r' {
+				advance(1)
+			} else if strings.HasPrefix(src[pos:], "//") {
+				advance(strings.IndexByte(src[pos:], '\n'))
+			} else if strings.HasPrefix(src[pos:], "/*") {
+				advance(strings.Index(src[pos:], "*/") + 2)
+			} else {
+				break
+			}
+		}
+		if !strings.HasPrefix(src[pos:], tk.Value) {
+			panic(fmt.Sprintf("token %q is not at offset %d", tk.Value, pos))
+		}
+		tk.Line, tk.Col, tk.Offset = line, pos-lineStart+1, pos
+		tokens = append(tokens, tk)
+		if tk.Type == StringLiteral {
+			advance(len(tk.Value) + 1) // the value leaves out the closing quote
+		} else {
+			advance(len(tk.Value))
+		}
+	}
+	return formatTokens(tokens)
+}
+
+// The .tokens files hold the tokens of regexTokenize, the lexer this one
+// replaced, so the lexer keeps producing the stream the parser was written
+// against. go test -update regenerates them from it.
+func TestTokenizeMatchesGolden(t *testing.T) {
+	sources, err := filepath.Glob("testdata/lexer/*.ay")
+	if err != nil || len(sources) == 0 {
+		t.Fatal("no sources in testdata/lexer")
+	}
+	for _, source := range sources {
+		t.Run(filepath.Base(source), func(t *testing.T) {
+			src, err := os.ReadFile(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			goldenFile := strings.TrimSuffix(source, ".ay") + ".tokens"
+			if *update {
+				if err := os.WriteFile(goldenFile, []byte(oldTokens(string(src))), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			golden, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(golden) != oldTokens(string(src)) {
+				t.Fatalf("%s is not what regexTokenize gives; run go test -update", goldenFile)
+			}
+
+			got := strings.Split(formatTokens(Tokenize(string(src))), "\n")
+			want := strings.Split(string(golden), "\n")
+			for i := range max(len(got), len(want)) {
+				var g, w string
+				if i < len(got) {
+					g = got[i]
+				}
+				if i < len(want) {
+					w = want[i]
+				}
+				if g != w {
+					t.Fatalf("token %d is %q, want %q", i+1, g, w)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkSource is the source the Tokenize benchmarks lex: the example
+// programs repeated into a long generated script, like the ones that made
+// lexing slow
+func benchmarkSource(b *testing.B) string {
+	var src strings.Builder
+	for _, source := range []string{"testdata/lexer/myprogram.ay", "testdata/lexer/readme.ay"} {
+		text, err := os.ReadFile(source)
+		if err != nil {
+			b.Fatal(err)
+		}
+		src.Write(text)
+		src.WriteString("\n")
+	}
+	return strings.Repeat(src.String(), 20)
+}
+
+func BenchmarkTokenize(b *testing.B) {
+	text := benchmarkSource(b)
+	b.SetBytes(int64(len(text)))
+	b.ResetTimer()
+	for range b.N {
+		Tokenize(text)
+	}
+}
+
+// BenchmarkRegexTokenize measures the lexer Tokenize replaced, for comparison
+func BenchmarkRegexTokenize(b *testing.B) {
+	text := benchmarkSource(b)
+	b.SetBytes(int64(len(text)))
+	b.ResetTimer()
+	for range b.N {
+		regexTokenize(text)
+	}
+}
+
+// lexErrors lexes src, returning its tokens, without the EOF, and the
+// problems reported
+func lexErrors(src string) ([]Token, []Diagnostic) {
+	var errors []Diagnostic
+	l := newLexer(strings.NewReader(src))
+	l.onError = func(at Token, code, message string) *Diagnostic {
+		errors = append(errors, diagnosticAt(SeverityError, at, code, message))
+		return &errors[len(errors)-1]
+	}
+	var tokens []Token
+	for tk := l.next(); tk.Type != EOF; tk = l.next() {
+		tokens = append(tokens, tk)
+	}
+	return tokens, errors
+}
+
+func TestOperatorRuns(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"a=-1", []string{"a", "=", "-", "1"}},
+		{"a==-1", []string{"a", "==", "-", "1"}},
+		{"a=!b", []string{"a", "=", "!", "b"}},
+		{"a++-b", []string{"a", "++", "-", "b"}},
+		{"a+=--b", []string{"a", "+=", "--", "b"}},
+		{"x |> f", []string{"x", "|>", "f"}},
+		{"p => -1", []string{"p", "=>", "-", "1"}},
+		{"def a -> b", []string{"def", "a", "-", ">", "b"}},
+		{"a+//c", []string{"a", "+"}},
+		{"a=/* c */b", []string{"a", "=", "b"}},
+	}
+	for _, test := range tests {
+		tokens, errors := lexErrors(test.src)
+		var got []string
+		for _, tk := range tokens {
+			if tk.Type != Whitespace {
+				got = append(got, tk.Value)
+			}
+		}
+		if strings.Join(got, " ") != strings.Join(test.want, " ") || len(errors) > 0 {
+			t.Errorf("%q lexes to %q with errors %v, want %q", test.src, got, errors, test.want)
+		}
+	}
+}
+
+func TestUnknownOperator(t *testing.T) {
+	for _, run := range []string{"===", "!==", "<=>", "**", "**=", ">>", "&", "|", "^", "&&="} {
+		src := "a " + run + " b"
+		tokens, errors := lexErrors(src)
+		if len(tokens) != 3 || tokens[1].Type != Unknown || tokens[1].Value != run {
+			t.Errorf("%q lexes to %v, want %q as one Unknown token", src, tokens, run)
+		}
+		if len(errors) != 1 || errors[0].Code != codeUnknownOperator {
+			t.Fatalf("%q reports %v, want one %s", src, errors, codeUnknownOperator)
+		}
+		if span := errors[0].Span; span.Start.Col != 3 || span.End.Col != 3+len(run) {
+			t.Errorf("%q reports the unknown operator at columns %d to %d, want the whole run", src, span.Start.Col, span.End.Col)
+		}
+
+		// The parser leaves the token to the lexer's error
+		p := NewParser("l x = " + src + "\n")
+		p.Start()
+		if len(p.Errors) != 1 || p.Errors[0].Code != codeUnknownOperator {
+			t.Errorf("parsing %q reports %v, want only %s", src, p.Errors, codeUnknownOperator)
+		}
+	}
+}
+
+func TestUnexpectedCharacterMessage(t *testing.T) {
+	_, errors := lexErrors(`a \ b`)
+	if len(errors) != 1 || errors[0].Message != `Unexpected character '\'` {
+		t.Errorf("got %v, want one Unexpected character '\\'", errors)
+	}
+}
+
+func TestUnexpectedCharacter(t *testing.T) {
+	tokens, errors := lexErrors("l q = 5 $ 3")
+	if len(tokens) != 6 || tokens[4].Type != Unknown || tokens[4].Value != "$" {
+		t.Errorf("got tokens %v, want $ kept as an Unknown token", tokens)
+	}
+	if len(errors) != 1 || errors[0].Code != codeUnexpectedCharacter || errors[0].Span.Start.Col != 9 {
+		t.Errorf("got %v, want one %s at column 9", errors, codeUnexpectedCharacter)
+	}
+
+	// The parser leaves the character to the lexer's error
+	for _, src := range []string{"l q = 5 $ 3\n", "print($)\n", "l a = [1, $, 2]\nprint(a)\n"} {
+		p := NewParser(src)
+		p.Start()
+		if len(p.Errors) != 1 || p.Errors[0].Code != codeUnexpectedCharacter {
+			t.Errorf("parsing %q reports %v, want only %s", src, p.Errors, codeUnexpectedCharacter)
+		}
+	}
+}
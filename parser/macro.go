@@ -0,0 +1,460 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// macro is a def declaration. Object-like macros (def var -> l) have no
+// params; parametric macros (def square(x) -> (x * x)) substitute their
+// arguments into the body. Bodies are kept as tokens and spliced into the
+// token stream on the way to the parser.
+type macro struct {
+	name   string
+	params []string
+	body   []Token
+}
+
+// tokensText joins token values back into readable source text
+func tokensText(tokens []Token) string {
+	var parts []string
+	for _, tk := range tokens {
+		if tk.Type == StringLiteral && tk.Value != "" {
+			// String values keep their opening quote, so close them with the same one
+			parts = append(parts, tk.Value+tk.Value[:1])
+		} else {
+			parts = append(parts, tk.Value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// tokenSource joins the source text of tokens kept with Options.Trivia,
+// including what comes before each one
+func tokenSource(tokens []Token) string {
+	var b strings.Builder
+	for _, tk := range tokens {
+		for _, trivia := range tk.Leading {
+			b.WriteString(trivia.Text)
+		}
+		b.WriteString(tk.Text)
+	}
+	return b.String()
+}
+
+// maxMacroDepth bounds nested expansions so a runaway macro can't hang the compiler
+const maxMacroDepth = 64
+
+// preprocessor records def declarations, drops code excluded by #if blocks
+// and expands def uses as tokens stream from the lexer to the parser. Def
+// lines themselves are left in place so the parser still sees them.
+type preprocessor struct {
+	p         *Parser
+	src       func() Token
+	pending   []Token // tokens read from src and given back, to be processed again
+	out       []Token // processed tokens waiting for the parser
+	conds     []condFrame
+	lineStart bool // the next token starts a line
+	ended     bool // src reached EOF and open #if blocks were reported
+
+	trivia  bool    // keep dropped tokens as the Leading of the next one
+	dropped []Token // trivia waiting for the next token
+}
+
+func newPreprocessor(p *Parser, src func() Token) *preprocessor {
+	return &preprocessor{p: p, src: src, lineStart: true}
+}
+
+// read returns the next unprocessed token
+func (pp *preprocessor) read() Token {
+	if len(pp.pending) > 0 {
+		tk := pp.pending[0]
+		pp.pending = pp.pending[1:]
+		return tk
+	}
+	return pp.src()
+}
+
+// unread gives tokens back to be processed again, before any others
+func (pp *preprocessor) unread(tokens ...Token) {
+	pp.pending = append(slices.Clone(tokens), pp.pending...)
+}
+
+// readLine reads the tokens up to the NewLine or EOF ending the line that
+// starts with first. The line end itself is given back.
+func (pp *preprocessor) readLine(first Token) []Token {
+	line := []Token{first}
+	for {
+		tk := pp.read()
+		if tk.Type == NewLine || tk.Type == EOF {
+			pp.unread(tk)
+			return line
+		}
+		line = append(line, tk)
+	}
+}
+
+// readUse reads the use of m starting at use: just the name for object-like
+// macros, or the name and its argument list, up to the ')' closing it.
+func (pp *preprocessor) readUse(m *macro, use Token) []Token {
+	tokens := []Token{use}
+	if m.params == nil {
+		return tokens
+	}
+	open := pp.read()
+	tokens = append(tokens, open)
+	if open.Value != "(" {
+		return tokens
+	}
+	for depth := 0; ; {
+		tk := pp.read()
+		tokens = append(tokens, tk)
+		switch tk.Value {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			if depth == 0 {
+				return tokens
+			}
+			depth--
+		}
+		if tk.Type == EOF {
+			return tokens
+		}
+	}
+}
+
+// next returns the next token for the parser
+func (pp *preprocessor) next() Token {
+	for len(pp.out) == 0 {
+		pp.process()
+	}
+	tk := pp.out[0]
+	pp.out = pp.out[1:]
+	if len(pp.dropped) > 0 {
+		tk.Leading = append(pp.dropped, tk.Leading...)
+		pp.dropped = nil
+	}
+	return tk
+}
+
+// drop leaves tokens out of the stream. With trivia they are kept, along
+// with their own Leading, for the Leading of the next token.
+func (pp *preprocessor) drop(tokens ...Token) {
+	if !pp.trivia {
+		return
+	}
+	for _, tk := range tokens {
+		pp.dropped = append(pp.dropped, tk.Leading...)
+		tk.Leading = nil
+		pp.dropped = append(pp.dropped, tk)
+	}
+}
+
+// process reads one token and queues whatever it stands for
+func (pp *preprocessor) process() {
+	p := pp.p
+	tk := pp.read()
+	lineStart := pp.lineStart
+	pp.lineStart = tk.Type == NewLine
+
+	// Directives (#if, #elif, #else, #end) must start a line
+	if tk.Type == Punctuation && tk.Value == "#" && lineStart {
+		line := pp.readLine(tk)
+		pp.conds = p.directive(line, pp.conds)
+		pp.drop(line...)
+		return
+	}
+
+	if tk.Type == EOF && !pp.ended {
+		pp.ended = true
+		for _, frame := range pp.conds {
+			p.addStandaloneErrorAt(frame.open, codeUnbalancedIf, "Unterminated #if block, expected #end")
+		}
+	}
+
+	// Dropped branches keep only their line breaks, so they never reach the parser
+	if !condActive(pp.conds) {
+		if tk.Type == NewLine || tk.Type == EOF {
+			pp.out = append(pp.out, tk)
+		} else {
+			pp.drop(tk)
+		}
+		return
+	}
+
+	if tk.Type == Keyword && tk.Value == "def" {
+		line := pp.readLine(tk)
+		if m := parseMacro(line); m != nil {
+			p.defines[m.name] = m
+		}
+		pp.out = append(pp.out, line...)
+		return
+	}
+
+	if tk.Type == Identifier {
+		if m, exists := p.defines[tk.Value]; exists {
+			use := pp.readUse(m, tk)
+			if expanded, next, ok := p.expandMacro(m, use, 0, nil); ok {
+				pp.out = append(pp.out, expanded...)
+				pp.unread(use[next:]...)
+				return
+			}
+			pp.unread(use[1:]...)
+		}
+	}
+
+	pp.out = append(pp.out, tk)
+}
+
+// defineValue turns a -D value into a define whose body is the tokenized value
+func defineValue(name, value string) *macro {
+	if value == "" {
+		value = "true"
+	}
+	var body []Token
+	for _, tk := range Tokenize(value) {
+		if tk.Type != NewLine && tk.Type != EOF {
+			body = append(body, tk)
+		}
+	}
+	return &macro{name: name, body: body}
+}
+
+// parseMacro reads a def line (def name [ (params) ] -> body). Malformed
+// lines return nil and are reported by parseDefine.
+func parseMacro(line []Token) *macro {
+	if len(line) < 2 || line[1].Type != Identifier {
+		return nil
+	}
+	m := &macro{name: line[1].Value}
+	i := 2
+
+	if i < len(line) && line[i].Value == "(" {
+		m.params = []string{}
+		i++
+		for i < len(line) && line[i].Value != ")" {
+			if line[i].Type != Identifier {
+				return nil
+			}
+			m.params = append(m.params, line[i].Value)
+			i++
+			if i < len(line) && line[i].Value == "," {
+				i++
+			}
+		}
+		if i >= len(line) {
+			return nil
+		}
+		i++ // skip ')'
+	}
+
+	if i+1 >= len(line) || line[i].Value != "-" || line[i+1].Value != ">" {
+		return nil
+	}
+	m.body = line[i+2:]
+	if len(m.body) == 0 {
+		return nil
+	}
+	return m
+}
+
+// expandMacro expands the use of m at tokens[i]. It returns the expansion, the
+// index of the first token after the use and whether anything was expanded.
+// active holds the macros currently being expanded, to catch recursion.
+func (p *Parser) expandMacro(m *macro, tokens []Token, i int, active []string) ([]Token, int, bool) {
+	use := tokens[i]
+
+	for _, name := range active {
+		if name == m.name {
+			p.addStandaloneErrorAt(use, codeDefRecursion, fmt.Sprintf("Recursive expansion of def '%s'", m.name))
+			return nil, i, false
+		}
+	}
+	if len(active) >= maxMacroDepth {
+		p.addStandaloneErrorAt(use, codeDefRecursion, fmt.Sprintf("def '%s' expands too deeply", m.name))
+		return nil, i, false
+	}
+
+	next := i + 1
+	var args [][]Token
+	if m.params != nil {
+		// A parametric macro name not followed by '(' is left alone
+		if next >= len(tokens) || tokens[next].Value != "(" {
+			return nil, i, false
+		}
+		var ok bool
+		args, next, ok = collectMacroArgs(tokens, next)
+		if !ok {
+			p.addStandaloneErrorAt(use, codeDefArguments, fmt.Sprintf("Unterminated argument list for def '%s'", m.name))
+			return nil, i, false
+		}
+		if len(args) != len(m.params) {
+			p.addStandaloneErrorAt(use, codeDefArguments, fmt.Sprintf("def '%s' expects %d argument(s), got %d", m.name, len(m.params), len(args)))
+			return nil, i, false
+		}
+		for j, arg := range args {
+			args[j] = p.rescan(arg, active)
+		}
+	}
+
+	body := p.substitute(m, args)
+
+	// Expanded tokens take the position of the whole use, and the first
+	// one stands for its source text
+	end := tokens[next-1].End
+	for j := range body {
+		body[j].Line = use.Line
+		body[j].Col = use.Col
+		body[j].Offset = use.Offset
+		body[j].End = end
+		body[j].Leading, body[j].Text = nil, ""
+	}
+	if len(body) > 0 {
+		body[0].Leading = use.Leading
+		body[0].Text = use.Text + tokenSource(tokens[i+1:next])
+	}
+
+	return p.rescan(body, append(active, m.name)), next, true
+}
+
+// rescan expands any macro uses left inside an expansion
+func (p *Parser) rescan(tokens []Token, active []string) []Token {
+	var out []Token
+	for i := 0; i < len(tokens); {
+		tk := tokens[i]
+		if tk.Type == Identifier {
+			if m, exists := p.defines[tk.Value]; exists {
+				expanded, next, ok := p.expandMacro(m, tokens, i, active)
+				if ok {
+					out = append(out, expanded...)
+					i = next
+					continue
+				}
+			}
+		}
+		out = append(out, tk)
+		i++
+	}
+	return out
+}
+
+// collectMacroArgs splits the parenthesized argument list starting at
+// tokens[open] on top-level commas. It returns the index after the ')'.
+func collectMacroArgs(tokens []Token, open int) ([][]Token, int, bool) {
+	var args [][]Token
+	var current []Token
+	depth := 0
+	for i := open + 1; i < len(tokens); i++ {
+		tk := tokens[i]
+		if tk.Type == EOF {
+			break
+		}
+		switch tk.Value {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			if depth == 0 {
+				if tk.Value != ")" {
+					return nil, i, false
+				}
+				if len(current) > 0 || len(args) > 0 {
+					args = append(args, current)
+				}
+				return args, i + 1, true
+			}
+			depth--
+		case ",":
+			if depth == 0 {
+				args = append(args, current)
+				current = nil
+				continue
+			}
+		}
+		if tk.Type != NewLine {
+			current = append(current, tk)
+		}
+	}
+	return nil, len(tokens), false
+}
+
+// substitute copies the macro body, replacing parameters with arguments and
+// renaming names the body declares itself (l name / f name) so they can't
+// clash with names at the use site. Arguments and a body that are
+// expressions with operators are wrapped in parentheses, so they keep their
+// meaning whatever surrounds them: square(3 + 1) is (3 + 1) * (3 + 1).
+func (p *Parser) substitute(m *macro, args [][]Token) []Token {
+	locals := make(map[string]string)
+	for j, tk := range m.body {
+		if tk.Type != Identifier || j == 0 {
+			continue
+		}
+		prev := m.body[j-1]
+		if prev.Type == Keyword && (prev.Value == "l" || prev.Value == "f") && !isParam(m, tk.Value) {
+			if _, seen := locals[tk.Value]; !seen {
+				p.gensym++
+				locals[tk.Value] = fmt.Sprintf("%s__%s%d", tk.Value, m.name, p.gensym)
+			}
+		}
+	}
+
+	var out []Token
+	for _, tk := range m.body {
+		if tk.Type == Identifier {
+			if idx := paramIndex(m, tk.Value); idx >= 0 {
+				out = append(out, group(args[idx])...)
+				continue
+			}
+			if renamed, ok := locals[tk.Value]; ok {
+				tk.Value = renamed
+			}
+		}
+		out = append(out, tk)
+	}
+	return group(out)
+}
+
+// group wraps tokens in parentheses if they are an expression with a binary
+// operator outside any brackets. Single tokens, statements and assignments
+// are left as they are, since parentheses would change what they mean.
+func group(tokens []Token) []Token {
+	if len(tokens) < 2 || tokens[0].Type == Keyword {
+		return tokens
+	}
+	hasOperator := false
+	depth := 0
+	for _, tk := range tokens {
+		switch {
+		case tk.Value == "(" || tk.Value == "[" || tk.Value == "{":
+			depth++
+		case tk.Value == ")" || tk.Value == "]" || tk.Value == "}":
+			depth--
+		case tk.Type == Operator && depth == 0:
+			if isAssignmentOperator(tk.Value) {
+				return tokens
+			}
+			hasOperator = true
+		}
+	}
+	if !hasOperator {
+		return tokens
+	}
+	first, last := tokens[0], tokens[len(tokens)-1]
+	open := Token{Type: Punctuation, Value: "(", Line: first.Line, Col: first.Col, Offset: first.Offset, End: first.Pos()}
+	close := Token{Type: Punctuation, Value: ")", Line: last.End.Line, Col: last.End.Col, Offset: last.End.Offset, End: last.End}
+	return append(append([]Token{open}, tokens...), close)
+}
+
+func isParam(m *macro, name string) bool {
+	return paramIndex(m, name) >= 0
+}
+
+func paramIndex(m *macro, name string) int {
+	for i, param := range m.params {
+		if param == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,410 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// parseMatch parses match expressions:
+//
+//	match value {
+//	    0 => "zero"
+//	    [x, y] => x + y
+//	    {kind: "err", msg} => msg
+//	    n if n > 100 => "big"
+//	    _ => "other"
+//	}
+//
+// Arms are tried in order. An arm's body is an expression or a block.
+func (p *Parser) parseMatch() *ASTNode {
+	matchToken := p.consume() // consume 'match'
+
+	subject := p.parseExpression()
+	if subject == nil {
+		p.addError(codeMatchSyntax, fmt.Sprintf("Expected value after '%s'", spell("match")))
+		return nil
+	}
+
+	if !p.expectTokenVal("{") {
+		p.addError(codeMatchSyntax, fmt.Sprintf("Expected '{' after %s value", spell("match")))
+		return nil
+	}
+	p.consume() // consume '{'
+
+	var arms []ASTNode
+	var armTokens []Token
+	for {
+		for p.expectToken(NewLine) || p.expectTokenVal(",") {
+			p.tokenizer.Next()
+		}
+		if p.expectTokenVal("}") || p.expectToken(EOF) {
+			break
+		}
+
+		armToken := p.tokenizer.GetCurrentToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		arms = append(arms, *arm)
+		armTokens = append(armTokens, armToken)
+
+		if !p.expectToken(NewLine) && !p.expectTokenVal(",") && !p.expectTokenVal("}") {
+			p.addError(codeMatchSyntax, "Expected new line, ',' or '}' after match arm")
+			return nil
+		}
+	}
+
+	if !p.expectTokenVal("}") {
+		p.addUnclosedError("}", fmt.Sprintf("Expected '}' to close %s", spell("match")))
+		return nil
+	}
+	p.consume() // consume '}'
+
+	if len(arms) == 0 {
+		p.addError(codeMatchSyntax, fmt.Sprintf("%s needs at least one arm", spell("match")))
+		return nil
+	}
+
+	p.checkMatchArms(arms, armTokens)
+	p.checkEnumCoverage(arms, matchToken)
+
+	return &ASTNode{
+		Type: MatchExpression,
+		Test: subject,
+		Body: arms,
+		Span: p.spanFrom(matchToken.Pos()),
+	}
+}
+
+// parseMatchArm parses pattern [if guard] => body
+func (p *Parser) parseMatchArm() *ASTNode {
+	start := p.here()
+	bound := map[string]bool{}
+	pattern := p.parsePattern(bound)
+	if pattern == nil {
+		return nil
+	}
+
+	var guard *ASTNode
+	if p.expectTokenVal("if") {
+		p.consume() // consume 'if'
+		guard = p.parseExpression()
+		if guard == nil {
+			p.addError(codeMatchSyntax, fmt.Sprintf("Expected condition after '%s' in match arm", spell("if")))
+			return nil
+		}
+	}
+
+	if !p.expectTokenVal("=>") {
+		p.addError(codeMatchSyntax, "Expected '=>' after match pattern")
+		return nil
+	}
+	p.consume() // consume '=>'
+	p.skipNewLines()
+
+	var body *ASTNode
+	if p.expectTokenVal("{") {
+		body = p.parseBlockStatement()
+	} else {
+		body = p.parseExpression()
+	}
+	if body == nil {
+		return nil
+	}
+
+	return &ASTNode{
+		Type:       MatchArm,
+		Left:       pattern,
+		Test:       guard,
+		Consequent: body,
+		Span:       p.spanFrom(start),
+	}
+}
+
+// parsePattern parses a match pattern: _, a binding name, a literal, an array
+// pattern [a, b, ...rest] or an object pattern {key: pattern, name}.
+// bound collects the names bound so far, to reject duplicates.
+func (p *Parser) parsePattern(bound map[string]bool) *ASTNode {
+	token := p.tokenizer.GetCurrentToken()
+
+	switch {
+	case p.expectTokenVal("["):
+		return p.parseArrayPattern(bound)
+	case p.expectTokenVal("{"):
+		return p.parseObjectPattern(bound)
+	case p.expectTokenVal("-") && p.expectPeek(Literal):
+		p.consume() // consume '-'
+		return &ASTNode{Type: LiteralD, Value: "-" + p.consume().Value, Span: p.spanFrom(token.Pos())}
+	case token.Type == Literal || token.Type == StringLiteral:
+		return &ASTNode{Type: LiteralD, Value: p.consume().Value, Span: p.spanFrom(token.Pos())}
+	case token.Type == Keyword && (token.Value == "true" || token.Value == "false" || token.Value == "null"):
+		return &ASTNode{Type: LiteralD, Value: p.consume().Value, Span: p.spanFrom(token.Pos())}
+	case token.Type == Identifier && p.expectPeekVal("."):
+		return p.parseMemberPattern()
+	case token.Type == Identifier:
+		name := p.consume().Value
+		if name != "_" {
+			if bound[name] {
+				p.addErrorAt(token, codeBoundTwice, fmt.Sprintf("'%s' is bound more than once in this pattern", token.Spelling()))
+			}
+			bound[name] = true
+		}
+		return &ASTNode{Type: IdentifierD, Value: name, Span: p.spanFrom(token.Pos())}
+	}
+
+	p.addError(codePatternSyntax, fmt.Sprintf("Unexpected token in pattern: %s", token.describe()))
+	return nil
+}
+
+// parseMemberPattern parses a constant such as Color.Red, which matches values
+// equal to it. Members of a known enum are checked against its declaration.
+func (p *Parser) parseMemberPattern() *ASTNode {
+	first := p.consume()
+	node := &ASTNode{Type: IdentifierD, Value: first.Value, Span: p.spanFrom(first.Pos())}
+	for p.expectTokenVal(".") {
+		p.consume() // consume '.'
+		if !p.expectToken(Identifier) && !p.expectToken(Keyword) {
+			p.addError(codePatternSyntax, "Expected property name after '.' in pattern")
+			return nil
+		}
+		nameToken := p.consume()
+		if node.Type == IdentifierD {
+			if members, ok := p.enums[node.Value]; ok && !slices.Contains(members, nameToken.Spelling()) {
+				p.addErrorAt(nameToken, codeNoEnumMember, fmt.Sprintf("Enum '%s' has no member '%s'", node.Value, nameToken.Spelling()))
+			}
+		}
+		node = &ASTNode{Type: MemberExpression, Identifier: nameToken.Spelling(), Left: node, Span: p.spanFrom(first.Pos())}
+	}
+	return node
+}
+
+// parseArrayPattern parses [p1, p2, ...rest]
+func (p *Parser) parseArrayPattern(bound map[string]bool) *ASTNode {
+	start := p.consume().Pos() // consume '['
+
+	node := &ASTNode{Type: ArrayExpr}
+	for {
+		p.skipNewLines()
+		if p.expectTokenVal("]") || p.expectToken(EOF) {
+			break
+		}
+
+		if p.expectTokenVal(".") {
+			// ...rest collects the remaining elements and must come last
+			for i := 0; i < 3; i++ {
+				if !p.expectTokenVal(".") {
+					p.addError(codePatternSyntax, "Expected '...' before rest name")
+					return nil
+				}
+				p.consume()
+			}
+			if !p.expectToken(Identifier) {
+				p.addError(codePatternSyntax, "Expected name after '...'")
+				return nil
+			}
+			restToken := p.tokenizer.GetCurrentToken()
+			rest := p.consume().Value
+			if bound[rest] {
+				p.addErrorAt(restToken, codeBoundTwice, fmt.Sprintf("'%s' is bound more than once in this pattern", restToken.Spelling()))
+			}
+			bound[rest] = true
+			node.Right = &ASTNode{Type: IdentifierD, Value: rest, Span: p.spanFrom(restToken.Pos())}
+			p.skipNewLines()
+			break
+		}
+
+		element := p.parsePattern(bound)
+		if element == nil {
+			return nil
+		}
+		node.Elements = append(node.Elements, *element)
+
+		p.skipNewLines()
+		if p.expectTokenVal(",") {
+			p.consume() // consume ','
+		} else if !p.expectTokenVal("]") {
+			p.addError(codePatternSyntax, "Expected ',' or ']' in array pattern")
+			return nil
+		}
+	}
+
+	if !p.expectTokenVal("]") {
+		p.addUnclosedError("]", "Expected ']' to close array pattern")
+		return nil
+	}
+	p.consume() // consume ']'
+	node.Span = p.spanFrom(start)
+	return node
+}
+
+// parseObjectPattern parses {key: pattern, name}
+func (p *Parser) parseObjectPattern(bound map[string]bool) *ASTNode {
+	start := p.consume().Pos() // consume '{'
+
+	node := &ASTNode{Type: ObjectExpr}
+	for {
+		p.skipNewLines()
+		if p.expectTokenVal("}") || p.expectToken(EOF) {
+			break
+		}
+
+		keyToken := p.tokenizer.GetCurrentToken()
+		var key string
+		switch keyToken.Type {
+		case Identifier, Keyword:
+			key = keyToken.Spelling()
+		case StringLiteral:
+			key = literalText(keyToken)
+		default:
+			p.addError(codePatternSyntax, "Expected key in object pattern")
+			return nil
+		}
+
+		var value *ASTNode
+		if p.expectPeekVal(":") {
+			p.consume() // consume key
+			p.consume() // consume ':'
+			p.skipNewLines()
+			value = p.parsePattern(bound)
+			if value == nil {
+				return nil
+			}
+		} else if keyToken.Type == Identifier {
+			// {name} binds the value of key name
+			value = p.parsePattern(bound)
+		} else {
+			p.addError(codePatternSyntax, "Expected ':' after key in object pattern")
+			return nil
+		}
+		node.Elements = append(node.Elements, ASTNode{Type: Property, Name: key, Initializer: value, Span: p.spanFrom(keyToken.Pos())})
+
+		p.skipNewLines()
+		if p.expectTokenVal(",") {
+			p.consume() // consume ','
+		} else if !p.expectTokenVal("}") {
+			p.addError(codePatternSyntax, "Expected ',' or '}' in object pattern")
+			return nil
+		}
+	}
+
+	if !p.expectTokenVal("}") {
+		p.addUnclosedError("}", "Expected '}' to close object pattern")
+		return nil
+	}
+	p.consume() // consume '}'
+	node.Span = p.spanFrom(start)
+	return node
+}
+
+// checkMatchArms warns about arms that can never match because an earlier arm
+// without a guard already matches everything they would
+func (p *Parser) checkMatchArms(arms []ASTNode, armTokens []Token) {
+	for j := range arms {
+		for i := 0; i < j; i++ {
+			if arms[i].Test == nil && patternCovers(*arms[i].Left, *arms[j].Left) {
+				p.addWarningAt(spanToken(Unknown, armTokens[j].Value, arms[j].Left.Span), codeUnreachableArm,
+					fmt.Sprintf("Unreachable match arm: the arm on line %d already matches everything this one does", armTokens[i].Line)).
+					withLabel("never reached").
+					withRelated(arms[i].Left.Span, "this arm matches first")
+				break
+			}
+		}
+	}
+}
+
+// checkEnumCoverage reports the members a match leaves out when its arms are
+// members of one known enum. Matches with a catch-all arm, or with patterns
+// that aren't members of that enum, are not checked.
+func (p *Parser) checkEnumCoverage(arms []ASTNode, matchToken Token) {
+	enum := ""
+	covered := map[string]bool{}
+	for _, arm := range arms {
+		pattern := *arm.Left
+		if pattern.Type == IdentifierD {
+			if arm.Test == nil {
+				return
+			}
+			continue
+		}
+		if pattern.Type != MemberExpression || pattern.Left.Type != IdentifierD {
+			return
+		}
+		if _, known := p.enums[pattern.Left.Value]; !known || (enum != "" && enum != pattern.Left.Value) {
+			return
+		}
+		enum = pattern.Left.Value
+		if arm.Test == nil {
+			covered[pattern.Identifier] = true
+		}
+	}
+	if enum == "" {
+		return
+	}
+
+	var missing []string
+	for _, member := range p.enums[enum] {
+		if !covered[member] {
+			missing = append(missing, enum+"."+member)
+		}
+	}
+	if len(missing) > 0 {
+		p.addErrorAt(matchToken, codeNonExhaustive, fmt.Sprintf("%s over enum '%s' does not cover %s", spell("match"), enum, strings.Join(missing, ", "))).
+			withNote("add an arm for each missing member, or a _ arm for all of them")
+	}
+}
+
+// patternCovers reports whether every value matching pattern b also matches pattern a
+func patternCovers(a, b ASTNode) bool {
+	switch a.Type {
+	case IdentifierD:
+		return true
+	case LiteralD:
+		return b.Type == LiteralD && literalKey(a.Value) == literalKey(b.Value)
+	case MemberExpression:
+		return b.Type == MemberExpression && compileNode(a) == compileNode(b)
+	case ArrayExpr:
+		if b.Type != ArrayExpr {
+			return false
+		}
+		if a.Right == nil && (b.Right != nil || len(a.Elements) != len(b.Elements)) {
+			return false
+		}
+		if len(b.Elements) < len(a.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !patternCovers(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case ObjectExpr:
+		if b.Type != ObjectExpr {
+			return false
+		}
+		for _, prop := range a.Elements {
+			found := false
+			for _, other := range b.Elements {
+				if other.Name == prop.Name && patternCovers(*prop.Initializer, *other.Initializer) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// literalKey normalizes a literal so "a" and 'a' compare equal
+func literalKey(value string) string {
+	if strings.HasPrefix(value, "'") {
+		return "\"" + value[1:]
+	}
+	return value
+}
@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// resolveNamedArgs rewrites calls with name: value arguments into plain
+// positional calls. Parameter names come from the functions and records
+// declared in the program, then from the runtime built-ins.
+func (p *Parser) resolveNamedArgs() {
+	signatures := map[string][]string{}
+	for i := range p.Nodes {
+		collectSignatures(&p.Nodes[i], signatures)
+	}
+	for i := range p.Nodes {
+		p.resolveCalls(&p.Nodes[i], signatures)
+	}
+}
+
+// collectSignatures records the parameter names of every named function and
+// record declared in node
+func collectSignatures(node *ASTNode, signatures map[string][]string) {
+	var name string
+	var params []ASTNode
+	switch {
+	case node.Type == FunctionDeclaration && node.Identifier != "":
+		name, params = node.Identifier, node.Params
+	case node.Type == RecordDecl:
+		name, params = node.Identifier, node.Params
+	case node.Type == VariableDeclaration && node.Initializer != nil && node.Initializer.Type == FunctionDeclaration:
+		// l name = f(params) { ... }
+		name, params = node.Identifier, node.Initializer.Params
+	}
+	if name != "" {
+		if _, seen := signatures[name]; !seen {
+			var names []string
+			for _, param := range params {
+				names = append(names, param.Value)
+			}
+			signatures[name] = names
+		}
+	}
+
+	for _, child := range node.children() {
+		collectSignatures(child, signatures)
+	}
+}
+
+// resolveCalls resolves named arguments in node and everything under it
+func (p *Parser) resolveCalls(node *ASTNode, signatures map[string][]string) {
+	switch node.Type {
+	case PipeExpression:
+		// The piped value fills the first parameter unless the call has a '_'
+		if node.Right.Type == CallExpression && countPlaceholders(node.Right.Args) == 0 {
+			p.resolveCall(node.Right, signatures, 1)
+		}
+	case CallExpression:
+		p.resolveCall(node, signatures, 0)
+	}
+
+	for _, child := range node.children() {
+		p.resolveCalls(child, signatures)
+	}
+}
+
+// resolveCall puts the named arguments of call in parameter order. skip is
+// the number of leading parameters filled by something other than the
+// argument list, like a piped value.
+func (p *Parser) resolveCall(call *ASTNode, signatures map[string][]string, skip int) {
+	firstNamed := slices.IndexFunc(call.Args, func(arg ASTNode) bool { return arg.Type == NamedArg })
+	if firstNamed < 0 {
+		return
+	}
+	at := namedArgToken(call.Args[firstNamed])
+
+	params, known := signatures[call.Identifier]
+	if call.Left != nil {
+		// recv.name(args) only becomes name(recv, args) for built-ins
+		params, known = Builtins[call.Identifier], rewritesToBuiltin(*call)
+		skip++
+	} else if !known {
+		params, known = Builtins[call.Identifier], isBuiltin(call.Identifier)
+	}
+	if !known {
+		p.addStandaloneErrorAt(at, codeNamedArgsUnknown, fmt.Sprintf("Named arguments need a function declared in this program or a built-in, and '%s' is neither", spell(call.Identifier)))
+		return
+	}
+	params = params[min(skip, len(params)):]
+
+	filled := make([]*ASTNode, len(params))
+	positional := firstNamed
+	for i := range call.Args {
+		arg := &call.Args[i]
+		if arg.Type != NamedArg {
+			if i > firstNamed {
+				p.addStandaloneErrorAt(at, codeNamedArgsOrder, fmt.Sprintf("Positional arguments must come before named arguments in call to '%s'", spell(call.Identifier)))
+				return
+			}
+			continue
+		}
+
+		idx := slices.Index(params, arg.Name)
+		switch {
+		case idx < 0 && slices.Contains(params, "..."+arg.Name):
+			p.addStandaloneErrorAt(namedArgToken(*arg), codeNamedRestParam, fmt.Sprintf("Rest parameter '%s' of '%s' can't be passed by name", spell(arg.Name), spell(call.Identifier)))
+		case idx < 0:
+			p.addStandaloneErrorAt(namedArgToken(*arg), codeNoSuchParameter, fmt.Sprintf("'%s' has no parameter named '%s' (parameters: %s)", spell(call.Identifier), spell(arg.Name), strings.Join(params, ", ")))
+		case idx < positional || filled[idx] != nil:
+			p.addStandaloneErrorAt(namedArgToken(*arg), codeArgumentTwice, fmt.Sprintf("Argument '%s' is given more than once in call to '%s'", spell(arg.Name), spell(call.Identifier)))
+		default:
+			filled[idx] = arg.Initializer
+		}
+	}
+
+	// Arguments run in the order they were written, not parameter order
+	order := make([]int, 0, len(call.Args))
+	for i := range positional {
+		order = append(order, i)
+	}
+	for _, arg := range call.Args[positional:] {
+		order = append(order, slices.Index(params, arg.Name))
+	}
+	for i := positional; i < len(call.Args) && call.ArgOrder == nil; i++ {
+		for j := i + 1; j < len(call.Args); j++ {
+			if order[i] > order[j] && orderMatters(*call.Args[i].Initializer, *call.Args[j].Initializer) {
+				call.ArgOrder = order
+				break
+			}
+		}
+	}
+
+	// Parameters skipped between named arguments get undefined, so JS defaults still apply
+	last := len(filled) - 1
+	for last >= positional && filled[last] == nil {
+		last--
+	}
+	args := append([]ASTNode{}, call.Args[:positional]...)
+	for idx := positional; idx <= last; idx++ {
+		if filled[idx] != nil {
+			args = append(args, *filled[idx])
+		} else {
+			args = append(args, ASTNode{Type: IdentifierD, Value: "undefined", Span: call.Span})
+		}
+	}
+	call.Args = args
+}
+
+// orderMatters reports whether evaluating a and b the other way round could
+// change what they do: literals never change, and reading two names is the
+// same either way, but a call may change a name or have other effects
+func orderMatters(a, b ASTNode) bool {
+	if a.Type == LiteralD || b.Type == LiteralD {
+		return false
+	}
+	return a.Type != IdentifierD || b.Type != IdentifierD
+}
+
+// namedArgToken rebuilds the token of a named argument's name, for errors
+func namedArgToken(arg ASTNode) Token {
+	return spanToken(Identifier, arg.Name, arg.Span)
+}
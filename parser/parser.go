@@ -2,6 +2,9 @@ package parser
 
 import (
 	"fmt"
+	"io"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -29,53 +32,191 @@ const (
 	ArrayIndex
 	IncDec
 	Error
+	SliceExpr
+	MemberExpression
+	PipeExpression
+	ObjectExpr
+	Property
+	ListComprehension
+	MapComprehension
+	CompFor
+	CompIf
+	MatchExpression
+	MatchArm
+	EnumDecl
+	RecordDecl
+	WithExpression
+	TryExpression
+	AwaitExpression
+	Contract
+	NamedArg
+	SpawnStmt
+	SelectStmt
+	SelectCase
 )
 
 // Parser represents the parser state
 type Parser struct {
 	tokenizer *TokenGen
 	Nodes     []ASTNode
-	Errors    []string
+	Errors    []Diagnostic
+	Warnings  []Diagnostic
 	vars      []Variable
-	defines   map[string]string
+	defines   map[string]*macro
+	gensym    int
+	enums     map[string][]string
+	funcDepth int
+	trivia    bool
+	loose     []Token // with trivia, the tokens outside every node
+	panicking bool    // a syntax error was reported and the parser hasn't resynchronized yet
+}
+
+// Options configures a parser beyond the source text itself
+type Options struct {
+	// Defines are predefined names, as if declared with def before the first line.
+	// They are visible to #if conditions and expand like any other define.
+	Defines map[string]string
+	// Trivia keeps whitespace, comments and every other byte of the source on
+	// the tokens, and gives each node the tokens it was parsed from, so tools
+	// such as formatters can rebuild the source from Program with Reconstruct
+	Trivia bool
 }
 
 // NewParser creates a new parser instance
 func NewParser(file string) *Parser {
-	return &Parser{
-		tokenizer: NewTokenGen(file),
+	return NewParserWithOptions(file, Options{})
+}
+
+// NewParserWithOptions creates a new parser instance with the given options
+func NewParserWithOptions(file string, opts Options) *Parser {
+	return NewParserReader(strings.NewReader(file), opts)
+}
+
+// NewParserReader creates a parser that reads source from r as it parses, so
+// the whole source never has to be in memory at once
+func NewParserReader(r io.Reader, opts Options) *Parser {
+	p := &Parser{
+		tokenizer: NewTokenGenReader(r),
 		Nodes:     []ASTNode{},
-		Errors:    []string{},
+		Errors:    []Diagnostic{},
+		Warnings:  []Diagnostic{},
 		vars:      []Variable{},
-		defines:   make(map[string]string),
-	}
+		defines:   make(map[string]*macro),
+		enums:     make(map[string][]string),
+	}
+	for name, value := range opts.Defines {
+		p.defines[name] = defineValue(name, value)
+	}
+	p.tokenizer.lexer.onError = p.addStandaloneErrorAt
+	pp := newPreprocessor(p, p.tokenizer.next)
+	p.tokenizer.next = pp.next
+	if opts.Trivia {
+		p.trivia = true
+		p.tokenizer.lexer.trivia = true
+		pp.trivia = true
+		// Keep every token moved past, to hand out to nodes once parsed
+		p.tokenizer.startRecording()
+	}
+	return p
 }
 
-// addError adds an error message with current token context
-func (p *Parser) addError(message string) {
-	line := p.tokenizer.GetCurrentLineNumber()
-	col := p.tokenizer.GetCurrentColNumber()
-	currentToken := p.tokenizer.GetCurrentToken()
+// addError adds an error pointing at the current token
+func (p *Parser) addError(code, message string) *Diagnostic {
+	return p.addErrorAt(p.tokenizer.GetCurrentToken(), code, message)
+}
 
-	// Get the actual source line
-	var actualSourceLine string
-	if line-1 < len(p.tokenizer.Lines) {
-		actualSourceLine = p.tokenizer.Lines[line-1]
-	} else {
-		actualSourceLine = "(empty line)"
+// addErrorAt adds an error pointing at the given token. After a syntax error
+// the parser is out of step with the source until it reaches the end of the
+// statement, so errors until then are left out, returning nil: they are
+// almost always the same mistake again.
+func (p *Parser) addErrorAt(at Token, code, message string) *Diagnostic {
+	if p.panicking {
+		return nil
+	}
+	p.panicking = true
+	// The lexer has already reported the operator or character at an Unknown token
+	if at.Type == Unknown {
+		return nil
 	}
+	return p.addStandaloneErrorAt(at, code, message)
+}
+
+// addStandaloneErrorAt adds an error that doesn't come from parsing a
+// statement: one found by the lexer, the preprocessor or a pass over the
+// finished tree. Panic mode never leaves these out.
+func (p *Parser) addStandaloneErrorAt(at Token, code, message string) *Diagnostic {
+	p.Errors = append(p.Errors, diagnosticAt(SeverityError, at, code, message))
+	return &p.Errors[len(p.Errors)-1]
+}
+
+// addUnclosedError reports a missing closing bracket at the current token,
+// pointing out the bracket left open and suggesting the closing one be added
+// after the last token read. The bracket is then taken as closed, so the
+// block around it reports its own.
+func (p *Parser) addUnclosedError(closer, message string) *Diagnostic {
+	d := p.addError(codeUnclosed, message).
+		withLabel(fmt.Sprintf("expected '%s'", closer)).
+		withFix(fmt.Sprintf("add '%s'", closer), p.tokenizer.prev().End, closer)
+	if open := p.tokenizer.openBracket(closer); open != nil {
+		d.withRelated(Span{Start: open.open.Pos(), End: open.open.End}, fmt.Sprintf("opening '%s' is here", open.open.Value))
+		p.tokenizer.closeBrackets(open.depth - 1)
+	}
+	return d
+}
 
-	// Create a pointer to show where the error is
-	pointer := strings.Repeat(" ", max(0, col-1)) + "^"
+// synchronize recovers from a syntax error in a statement that started with
+// depth brackets open. It skips to the end of that statement: the line break
+// or ';' ending it, passing over whole bracketed parts, or the bracket closing
+// the block around it, which is left for the block. A line starting with a
+// declaration also ends it, closing any brackets the mistake left open.
+func (p *Parser) synchronize(depth int) {
+	for p.panicking {
+		tk := p.tokenizer.GetCurrentToken()
+		switch {
+		case tk.Type == EOF, p.tokenizer.depth() < depth:
+			p.panicking = false
+		case p.tokenizer.depth() == depth && (tk.Type == NewLine || tk.Type == Punctuation && tk.Value == ";"):
+			p.tokenizer.Next()
+			p.panicking = false
+		case tk.Type == NewLine && p.startsDeclaration(p.tokenizer.Peek(0), p.tokenizer.Peek(1)):
+			p.tokenizer.Next()
+			p.tokenizer.closeBrackets(depth)
+			p.panicking = false
+		case depth > 0 && p.tokenizer.opener(tk) >= 0 && p.tokenizer.opener(tk) < depth:
+			p.panicking = false
+		default:
+			p.tokenizer.Next()
+		}
+	}
+}
 
-	errorMsg := fmt.Sprintf(`
-Error at Line %d, Column %d: %s
-%s
-%s
+// startsDeclaration reports whether tk, followed by next, starts a
+// declaration. Unlike other statements, these can't continue an expression
+// from the line before.
+func (p *Parser) startsDeclaration(tk, next Token) bool {
+	if tk.Type != Keyword {
+		return false
+	}
+	switch tk.Value {
+	case "l", "def", "enum", "record":
+		return true
+	case "f":
+		// f( is a function expression, which can be an argument
+		return next.Type == Identifier
+	}
+	return false
+}
 
-Current token: "%s" (%d)`, line, col, message, actualSourceLine, pointer, currentToken.Value, currentToken.Type)
+// addWarningAt adds a warning pointing at the given token. Warnings don't stop compilation.
+func (p *Parser) addWarningAt(at Token, code, message string) *Diagnostic {
+	p.Warnings = append(p.Warnings, diagnosticAt(SeverityWarning, at, code, message))
+	return &p.Warnings[len(p.Warnings)-1]
+}
 
-	p.Errors = append(p.Errors, errorMsg)
+// Line returns the text of source line n (1-based), for rendering
+// diagnostics. Lines not read yet, or no longer kept, report false.
+func (p *Parser) Line(n int) (string, bool) {
+	return p.tokenizer.Line(n)
 }
 
 // Helper function for max
@@ -86,26 +227,25 @@ func max(a, b int) int {
 	return b
 }
 
-// resolveDefine resolves defined aliases
-func (p *Parser) resolveDefine(value string) string {
-	if resolved, exists := p.defines[value]; exists {
-		return resolved
+// here returns where the current token starts, for nodes that begin with it
+func (p *Parser) here() Pos {
+	return p.tokenizer.GetCurrentToken().Pos()
+}
+
+// spanFrom returns the span from start to the end of the last token consumed
+func (p *Parser) spanFrom(start Pos) Span {
+	end := p.tokenizer.prev().End
+	if end.Offset < start.Offset {
+		end = start
 	}
-	return value
+	return Span{Start: start, End: end}
 }
 
 // consume returns current token and advances to next
 func (p *Parser) consume() Token {
 	token := p.tokenizer.GetCurrentToken()
-	// Create a new token with resolved value if it's a define
-	resolvedToken := Token{
-		Type:  token.Type,
-		Value: p.resolveDefine(token.Value),
-		Line:  token.Line,
-		Col:   token.Col,
-	}
 	p.tokenizer.Next()
-	return resolvedToken
+	return token
 }
 
 // expectPeek checks if next token matches expected type
@@ -123,15 +263,13 @@ func (p *Parser) expectToken(t int) bool {
 // expectPeekVal checks if next token matches expected value
 func (p *Parser) expectPeekVal(v string) bool {
 	pk := p.tokenizer.Peek(0)
-	resolvedValue := p.resolveDefine(pk.Value)
-	return pk.Value == v || resolvedValue == v
+	return pk.Value == v
 }
 
 // expectTokenVal checks if current token matches expected value
 func (p *Parser) expectTokenVal(v string) bool {
 	tk := p.tokenizer.GetCurrentToken()
-	resolvedValue := p.resolveDefine(tk.Value)
-	return tk.Value == v || resolvedValue == v
+	return tk.Value == v
 }
 
 // consumeOptionalSemicolon consumes a semicolon if present (semicolons are optional in AY)
@@ -155,13 +293,27 @@ func (p *Parser) Start() {
 		if node != nil {
 			p.Nodes = append(p.Nodes, *node)
 		}
+		p.synchronize(0)
 
 		// Safety check: if we haven't advanced, force advance to prevent infinite loop
 		if p.tokenizer.CurrentTokenNo == currentPos && p.tokenizer.GetCurrentToken().Type != EOF {
-			fmt.Printf("[DEBUG] Force advancing from token: %+v\n", p.tokenizer.GetCurrentToken())
 			p.tokenizer.Next()
 		}
 	}
+
+	if err := p.tokenizer.Err(); err != nil {
+		p.addStandaloneErrorAt(p.tokenizer.GetCurrentToken(), codeReadFailed, fmt.Sprintf("Could not read the rest of the source: %v", err))
+	}
+
+	p.resolveNamedArgs()
+	p.awaitBlockingCalls()
+
+	if p.trivia {
+		tokens := append(p.tokenizer.stopRecording(0), p.tokenizer.GetCurrentToken())
+		program := p.Program()
+		attachTokens(&program, tokens)
+		p.loose = program.Tokens
+	}
 }
 
 // parseStatement parses a statement
@@ -183,6 +335,31 @@ func (p *Parser) parseStatement() *ASTNode {
 		return p.parseFunction()
 	}
 
+	// Enum declaration: enum Name { A, B = 5 }
+	if p.expectTokenVal("enum") {
+		return p.parseEnum()
+	}
+
+	// Record declaration: record Point(x, y)
+	if p.expectTokenVal("record") {
+		return p.parseRecord()
+	}
+
+	// Spawn statement: spawn worker(ch)
+	if p.expectTokenVal("spawn") {
+		return p.parseSpawn()
+	}
+
+	// Select statement: select { l v = recv(ch) => ... }
+	if p.expectTokenVal("select") {
+		return p.parseSelect()
+	}
+
+	// Assert statement: assert cond, "message"
+	if p.expectTokenVal("assert") {
+		return p.parseContract()
+	}
+
 	// Return statement
 	if p.expectTokenVal("return") {
 		return p.parseReturn()
@@ -191,13 +368,13 @@ func (p *Parser) parseStatement() *ASTNode {
 	// Break statement
 	if p.expectTokenVal("break") {
 		p.consume()
-		return &ASTNode{Type: Break}
+		return &ASTNode{Type: Break, Span: p.spanFrom(token.Pos())}
 	}
 
 	// Continue statement
 	if p.expectTokenVal("continue") {
 		p.consume()
-		return &ASTNode{Type: Continue}
+		return &ASTNode{Type: Continue, Span: p.spanFrom(token.Pos())}
 	}
 
 	// If statement
@@ -210,11 +387,20 @@ func (p *Parser) parseStatement() *ASTNode {
 		return p.parseLoop()
 	}
 
+	// Match or await used as a statement
+	if p.expectTokenVal("match") || p.expectTokenVal("await") {
+		node := p.parseExpression()
+		if node != nil {
+			p.consumeOptionalSemicolon()
+		}
+		return node
+	}
+
 	// Function call or expression statement
 	if p.expectToken(Identifier) {
 		// Check if it's a function call
 		if p.expectPeekVal("(") {
-			node := p.parseCallExpr()
+			node := p.parsePostfix(p.parseCallExpr())
 			if node != nil {
 				// Consume optional semicolon after function call statement
 				p.consumeOptionalSemicolon()
@@ -237,51 +423,78 @@ func (p *Parser) parseStatement() *ASTNode {
 
 	// Skip unknown tokens with error
 	if token.Type != EOF {
-		p.addError(fmt.Sprintf("Unexpected token: %s", token.Value))
+		p.addError(codeUnexpectedToken, fmt.Sprintf("Unexpected token: %s", token.describe()))
 		p.tokenizer.Next()
 	}
 
 	return nil
 }
 
-// parseDefine parses define statements (def identifier -> value)
+// parseDefine parses define statements (def identifier -> value, def name(params) -> body).
+// Uses of the define were already expanded by the preprocessor; this only checks the syntax
+// and keeps a DefDecl node for the declaration.
 func (p *Parser) parseDefine() *ASTNode {
-	p.consume() // consume 'def'
+	start := p.consume().Pos() // consume 'def'
 
 	if !p.expectToken(Identifier) {
-		p.addError("Expected identifier after 'def'")
+		p.addError(codeDefSyntax, fmt.Sprintf("Expected identifier after '%s'", spell("def")))
 		return nil
 	}
 
 	identifier := p.consume().Value
 
+	var params []ASTNode
+	if p.expectTokenVal("(") {
+		p.consume() // consume '('
+		for !p.expectTokenVal(")") {
+			if !p.expectToken(Identifier) {
+				p.addError(codeDefSyntax, fmt.Sprintf("Expected parameter name in define '%s'", identifier))
+				return nil
+			}
+			param := p.consume()
+			params = append(params, ASTNode{
+				Type:  IdentifierD,
+				Value: param.Value,
+				Span:  p.spanFrom(param.Pos()),
+			})
+			if p.expectTokenVal(",") {
+				p.consume()
+			} else if !p.expectTokenVal(")") {
+				p.addError(codeDefSyntax, fmt.Sprintf("Expected ',' or ')' in define '%s'", identifier))
+				return nil
+			}
+		}
+		p.consume() // consume ')'
+	}
+
 	if !p.expectTokenVal("-") {
-		p.addError("Expected '-' after identifier in define statement")
+		p.addError(codeDefSyntax, "Expected '-' after identifier in define statement")
 		return nil
 	}
 	p.consume() // consume '-'
 
 	if !p.expectTokenVal(">") {
-		p.addError("Expected '>' after '-' in define statement")
+		p.addError(codeDefSyntax, "Expected '>' after '-' in define statement")
 		return nil
 	}
 	p.consume() // consume '>'
 
-	// Get the value/replacement
-	if p.tokenizer.GetCurrentToken().Type == EOF {
-		p.addError("Expected value after '->' in define statement")
+	// The replacement runs to the end of the line
+	var body []Token
+	for !p.expectToken(NewLine) && !p.expectToken(EOF) {
+		body = append(body, p.consume())
+	}
+	if len(body) == 0 {
+		p.addError(codeDefSyntax, "Expected value after '->' in define statement")
 		return nil
 	}
 
-	value := p.consume().Value
-
-	// Store the define mapping
-	p.defines[identifier] = value
-
 	return &ASTNode{
 		Type:       DefDecl,
 		Identifier: identifier,
-		Value:      value,
+		Params:     params,
+		Value:      tokensText(body),
+		Span:       p.spanFrom(start),
 	}
 }
 
@@ -297,10 +510,10 @@ func (p *Parser) parseVariableDeclaration() *ASTNode {
 
 // parseVariableDeclarationNoSemicolon parses variable declarations without consuming semicolon
 func (p *Parser) parseVariableDeclarationNoSemicolon() *ASTNode {
-	p.consume() // consume 'l'
+	start := p.consume().Pos() // consume 'l'
 
 	if !p.expectToken(Identifier) {
-		p.addError("Expected identifier after 'l'")
+		p.addError(codeVariableSyntax, fmt.Sprintf("Expected identifier after '%s'", spell("l")))
 		return nil
 	}
 
@@ -323,10 +536,11 @@ func (p *Parser) parseVariableDeclarationNoSemicolon() *ASTNode {
 		Type:        VariableDeclaration,
 		Identifier:  identifier,
 		Initializer: initializer,
+		Span:        p.spanFrom(start),
 	}
 } // parseFunction parses function declarations
 func (p *Parser) parseFunction() *ASTNode {
-	p.consume() // consume 'f'
+	start := p.consume().Pos() // consume 'f'
 
 	// Function name (optional for anonymous functions)
 	var identifier string
@@ -336,7 +550,7 @@ func (p *Parser) parseFunction() *ASTNode {
 
 	// Parameters
 	if !p.expectTokenVal("(") {
-		p.addError("Expected '(' after function identifier")
+		p.addError(codeFunctionSyntax, "Expected '(' after function identifier")
 		return nil
 	}
 	p.consume() // consume '('
@@ -348,33 +562,57 @@ func (p *Parser) parseFunction() *ASTNode {
 			params = append(params, ASTNode{
 				Type:  IdentifierD,
 				Value: param.Value,
+				Span:  p.spanFrom(param.Pos()),
 			})
 
 			if p.expectTokenVal(",") {
 				p.consume()
 			} else if !p.expectTokenVal(")") {
-				p.addError("Expected ',' or ')' in parameter list")
+				p.addError(codeFunctionSyntax, "Expected ',' or ')' in parameter list")
 				break
 			}
 		} else {
-			p.addError("Expected parameter name")
+			p.addError(codeFunctionSyntax, "Expected parameter name")
 			break
 		}
 	}
 
 	if !p.expectTokenVal(")") {
-		p.addError("Expected ')' after parameters")
+		p.addUnclosedError(")", "Expected ')' after parameters")
 		return nil
 	}
 	p.consume() // consume ')'
 
+	// Contract clauses between the parameters and the body
+	var contracts []ASTNode
+	for {
+		p.skipNewLines()
+		if !p.expectTokenVal("requires") && !p.expectTokenVal("ensures") {
+			break
+		}
+		clause := p.parseContract()
+		if clause == nil {
+			return nil
+		}
+		if clause.Name == "ensures" {
+			for _, param := range params {
+				if param.Value == "result" {
+					p.addError(codeResultParameter, fmt.Sprintf("'%s' clauses call the return value 'result', so no parameter can have that name", spell("ensures")))
+				}
+			}
+		}
+		contracts = append(contracts, *clause)
+	}
+
 	// Function body
 	if !p.expectTokenVal("{") {
-		p.addError("Expected '{' to start function body")
+		p.addError(codeFunctionSyntax, "Expected '{' to start function body")
 		return nil
 	}
 
+	p.funcDepth++
 	body := p.parseBlockStatement()
+	p.funcDepth--
 	if body == nil {
 		return nil
 	}
@@ -384,12 +622,214 @@ func (p *Parser) parseFunction() *ASTNode {
 		Identifier: identifier,
 		Params:     params,
 		Body:       body.Body,
+		Contracts:  contracts,
+		Span:       p.spanFrom(start),
+	}
+}
+
+// sourceText returns the source code the tokens were read from. Tokens that
+// span lines or came from a def expansion are rebuilt with tokensText instead.
+func (p *Parser) sourceText(tokens []Token) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+	first, last := tokens[0], tokens[len(tokens)-1]
+	line, ok := p.tokenizer.Line(first.Line)
+	if first.Line != last.Line || !ok {
+		return tokensText(tokens)
+	}
+	// Offsets within the line
+	start := p.tokenizer.lineOffset(first.Line)
+	for _, tk := range tokens {
+		i := tk.Offset - start
+		if i < 0 || i > len(line) || !strings.HasPrefix(line[i:], tk.Spelling()) {
+			return tokensText(tokens)
+		}
+	}
+	end := last.Offset - start + len(last.Spelling())
+	if last.Type == StringLiteral && end < len(line) {
+		end++ // closing quote
+	}
+	return line[first.Offset-start : end]
+}
+
+// parseContract parses assert statements and requires/ensures clauses:
+// keyword condition [, message]. Without a message, the failure report
+// shows the condition's source.
+func (p *Parser) parseContract() *ASTNode {
+	keyword := p.consume()
+
+	mark := p.tokenizer.startRecording()
+	test := p.parseExpression()
+	tokens := p.tokenizer.stopRecording(mark)
+	if test == nil {
+		p.addError(codeContractSyntax, fmt.Sprintf("Expected condition after '%s'", keyword.Spelling()))
+		return nil
+	}
+	source := p.sourceText(tokens)
+
+	var message *ASTNode
+	if p.expectTokenVal(",") {
+		p.consume() // consume ','
+		message = p.parseExpression()
+		if message == nil {
+			p.addError(codeContractSyntax, fmt.Sprintf("Expected message after ',' in '%s'", keyword.Spelling()))
+			return nil
+		}
+	}
+
+	return &ASTNode{
+		Type:        Contract,
+		Name:        keyword.Value,
+		Value:       source,
+		Test:        test,
+		Initializer: message,
+		Span:        p.spanFrom(keyword.Pos()),
+	}
+}
+
+// parseEnum parses enum declarations. Members without a value count up from
+// the previous numeric value, starting at 0.
+func (p *Parser) parseEnum() *ASTNode {
+	start := p.consume().Pos() // consume 'enum'
+
+	if !p.expectToken(Identifier) {
+		p.addError(codeEnumSyntax, fmt.Sprintf("Expected enum name after '%s'", spell("enum")))
+		return nil
+	}
+	identifier := p.consume().Value
+
+	if !p.expectTokenVal("{") {
+		p.addError(codeEnumSyntax, fmt.Sprintf("Expected '{' after enum name '%s'", identifier))
+		return nil
+	}
+	p.consume() // consume '{'
+
+	var members []ASTNode
+	var names []string
+	next, counting := 0, true
+	for {
+		for p.expectToken(NewLine) || p.expectTokenVal(",") {
+			p.tokenizer.Next()
+		}
+		if p.expectTokenVal("}") || p.expectToken(EOF) {
+			break
+		}
+
+		if !p.expectToken(Identifier) {
+			p.addError(codeEnumSyntax, fmt.Sprintf("Expected member name in enum '%s'", identifier))
+			return nil
+		}
+		memberToken := p.consume()
+		name := memberToken.Spelling()
+		if slices.Contains(names, name) {
+			p.addErrorAt(memberToken, codeDuplicateMember, fmt.Sprintf("Duplicate member '%s' in enum '%s'", memberToken.Spelling(), identifier))
+		}
+
+		var value string
+		var valueSpan Span
+		if p.expectTokenVal("=") {
+			p.consume() // consume '='
+			valueStart := p.here()
+			negative := ""
+			if p.expectTokenVal("-") {
+				p.consume()
+				negative = "-"
+			}
+			if !p.expectToken(Literal) && !(negative == "" && p.expectToken(StringLiteral)) {
+				p.addError(codeEnumValue, fmt.Sprintf("Enum member '%s' needs a number or string value", memberToken.Spelling()))
+				return nil
+			}
+			valueToken := p.consume()
+			value = negative + valueToken.Value
+			valueSpan = p.spanFrom(valueStart)
+			n, err := strconv.Atoi(value)
+			next, counting = n+1, err == nil
+		} else {
+			if !counting {
+				p.addErrorAt(memberToken, codeEnumValue, fmt.Sprintf("Enum member '%s' needs a value, the one before it is not an integer", memberToken.Spelling()))
+			}
+			value = strconv.Itoa(next)
+			next++
+			valueSpan = p.spanFrom(memberToken.Pos())
+		}
+
+		names = append(names, name)
+		members = append(members, ASTNode{
+			Type:        Property,
+			Name:        name,
+			Initializer: &ASTNode{Type: LiteralD, Value: value, Span: valueSpan},
+			Span:        p.spanFrom(memberToken.Pos()),
+		})
+	}
+
+	if !p.expectTokenVal("}") {
+		p.addUnclosedError("}", fmt.Sprintf("Expected '}' to close enum '%s'", identifier))
+		return nil
+	}
+	p.consume() // consume '}'
+
+	p.enums[identifier] = names
+
+	return &ASTNode{
+		Type:       EnumDecl,
+		Identifier: identifier,
+		Elements:   members,
+		Span:       p.spanFrom(start),
+	}
+}
+
+// parseRecord parses record declarations. A record is a constructor for
+// frozen objects with the given fields.
+func (p *Parser) parseRecord() *ASTNode {
+	start := p.consume().Pos() // consume 'record'
+
+	if !p.expectToken(Identifier) {
+		p.addError(codeRecordSyntax, fmt.Sprintf("Expected record name after '%s'", spell("record")))
+		return nil
+	}
+	identifier := p.consume().Value
+
+	if !p.expectTokenVal("(") {
+		p.addError(codeRecordSyntax, fmt.Sprintf("Expected '(' after record name '%s'", identifier))
+		return nil
+	}
+	p.consume() // consume '('
+
+	var fields []ASTNode
+	for !p.expectTokenVal(")") {
+		if !p.expectToken(Identifier) {
+			p.addError(codeRecordSyntax, fmt.Sprintf("Expected field name in record '%s'", identifier))
+			return nil
+		}
+		fieldToken := p.consume()
+		for _, field := range fields {
+			if field.Value == fieldToken.Value {
+				p.addErrorAt(fieldToken, codeDuplicateMember, fmt.Sprintf("Duplicate field '%s' in record '%s'", fieldToken.Spelling(), identifier))
+			}
+		}
+		fields = append(fields, ASTNode{Type: IdentifierD, Value: fieldToken.Value, Name: fieldToken.Spelling(), Span: p.spanFrom(fieldToken.Pos())})
+
+		if p.expectTokenVal(",") {
+			p.consume() // consume ','
+		} else if !p.expectTokenVal(")") {
+			p.addError(codeRecordSyntax, fmt.Sprintf("Expected ',' or ')' in record '%s'", identifier))
+			return nil
+		}
+	}
+	p.consume() // consume ')'
+
+	return &ASTNode{
+		Type:       RecordDecl,
+		Identifier: identifier,
+		Params:     fields,
+		Span:       p.spanFrom(start),
 	}
 }
 
 // parseReturn parses return statements
 func (p *Parser) parseReturn() *ASTNode {
-	p.consume() // consume 'return'
+	start := p.consume().Pos() // consume 'return'
 
 	var initializer *ASTNode
 	if !p.expectToken(NewLine) && p.tokenizer.GetCurrentToken().Type != EOF {
@@ -399,6 +839,7 @@ func (p *Parser) parseReturn() *ASTNode {
 	node := &ASTNode{
 		Type:        Return,
 		Initializer: initializer,
+		Span:        p.spanFrom(start),
 	}
 
 	// Consume optional semicolon
@@ -410,10 +851,10 @@ func (p *Parser) parseReturn() *ASTNode {
 // parseBlockStatement parses block statements
 func (p *Parser) parseBlockStatement() *ASTNode {
 	if !p.expectTokenVal("{") {
-		p.addError("Expected '{'")
+		p.addError(codeUnexpectedToken, "Expected '{'")
 		return nil
 	}
-	p.consume() // consume '{'
+	start := p.consume().Pos() // consume '{'
 
 	var body []ASTNode
 	for !p.expectTokenVal("}") && p.tokenizer.GetCurrentToken().Type != EOF {
@@ -423,14 +864,16 @@ func (p *Parser) parseBlockStatement() *ASTNode {
 			continue
 		}
 
+		depth := p.tokenizer.depth()
 		stmt := p.parseStatement()
 		if stmt != nil {
 			body = append(body, *stmt)
 		}
+		p.synchronize(depth)
 	}
 
 	if !p.expectTokenVal("}") {
-		p.addError("Expected '}' to close block")
+		p.addUnclosedError("}", "Expected '}' to close block")
 		return nil
 	}
 	p.consume() // consume '}'
@@ -438,11 +881,63 @@ func (p *Parser) parseBlockStatement() *ASTNode {
 	return &ASTNode{
 		Type: BlockStmt,
 		Body: body,
+		Span: p.spanFrom(start),
 	}
 }
 
-// parseExpression parses expressions
+// parseExpression parses expressions. The pipeline operator |> binds looser than
+// every other operator except assignment, and chains left to right.
 func (p *Parser) parseExpression() *ASTNode {
+	left := p.parseBinaryExpression()
+
+	for left != nil && p.expectTokenVal("|>") {
+		p.consume() // consume '|>'
+		right := p.parseBinaryExpression()
+		if right == nil {
+			p.addError(codePipelineSyntax, "Expected function after '|>'")
+			return nil
+		}
+		if right.Type == CallExpression && countPlaceholders(right.Args) > 1 {
+			p.addError(codePipelineSyntax, "Pipeline placeholder '_' can only be used once per call")
+		}
+
+		left = &ASTNode{
+			Type:     PipeExpression,
+			Operator: "|>",
+			Left:     left,
+			Right:    right,
+			Span:     p.spanFrom(left.Span.Start),
+		}
+	}
+
+	return left
+}
+
+// countPlaceholders counts the pipeline placeholder '_' among call arguments
+func countPlaceholders(args []ASTNode) int {
+	count := 0
+	for _, arg := range args {
+		if arg.Type == NamedArg {
+			arg = *arg.Initializer
+		}
+		if arg.Type == IdentifierD && arg.Value == "_" {
+			count++
+		}
+	}
+	return count
+}
+
+// parseBinaryExpression parses operands and binary operators
+func (p *Parser) parseBinaryExpression() *ASTNode {
+	left := p.parseOperand()
+	if left == nil {
+		return nil
+	}
+	return p.parseBinaryOps(left, 0)
+}
+
+// parseOperand parses a single operand of a binary expression
+func (p *Parser) parseOperand() *ASTNode {
 	var left *ASTNode
 
 	if p.expectTokenVal("(") {
@@ -454,6 +949,12 @@ func (p *Parser) parseExpression() *ASTNode {
 		left = p.parseCallExpr()
 	} else if p.expectTokenVal("[") {
 		left = p.parseArray()
+	} else if p.expectTokenVal("{") {
+		left = p.parseObject()
+	} else if p.expectTokenVal("match") {
+		left = p.parseMatch()
+	} else if p.expectTokenVal("await") {
+		left = p.parseAwait()
 	} else if p.expectToken(Identifier) && p.expectPeekVal("[") {
 		left = p.parseArrIndex()
 	} else if p.expectTokenVal("f") {
@@ -465,14 +966,35 @@ func (p *Parser) parseExpression() *ASTNode {
 		left = p.parsePrimary()
 	}
 
-	if left == nil {
-		return nil
-	}
+	return p.parsePostfix(left)
+}
 
-	// Handle binary operations
+// parseBinaryOps parses the binary operators following left whose precedence
+// is at least minPrec, grouping tighter operators first
+func (p *Parser) parseBinaryOps(left *ASTNode, minPrec int) *ASTNode {
 	for p.expectToken(Operator) && p.isBinaryOperator() {
-		operator := p.consume().Value
-		right := p.parseExpression()
+		operator := p.tokenizer.GetCurrentToken().Value
+		prec := binaryPrecedence(operator)
+		if prec < minPrec {
+			break
+		}
+		if isAssignmentOperator(operator) && left.Type == ArrayIndex &&
+			left.Index[len(left.Index)-1].Type == SliceExpr {
+			p.addError(codeSliceAssignment, "Cannot assign to a slice")
+		}
+		p.consume() // consume operator
+
+		// Assignment takes everything to its right, pipelines included
+		var right *ASTNode
+		if isAssignmentOperator(operator) {
+			right = p.parseExpression()
+		} else {
+			right = p.parseOperand()
+			for right != nil && p.expectToken(Operator) && p.isBinaryOperator() &&
+				binaryPrecedence(p.tokenizer.GetCurrentToken().Value) > prec {
+				right = p.parseBinaryOps(right, prec+1)
+			}
+		}
 		if right == nil {
 			break
 		}
@@ -482,6 +1004,7 @@ func (p *Parser) parseExpression() *ASTNode {
 			Operator: operator,
 			Left:     left,
 			Right:    right,
+			Span:     p.spanFrom(left.Span.Start),
 		}
 	}
 
@@ -500,6 +1023,34 @@ func (p *Parser) isBinaryOperator() bool {
 	return false
 }
 
+// binaryPrecedence ranks binary operators from loosest (assignment) to tightest
+func binaryPrecedence(op string) int {
+	switch op {
+	case "||":
+		return 1
+	case "&&":
+		return 2
+	case "==", "!=":
+		return 3
+	case "<", ">", "<=", ">=":
+		return 4
+	case "+", "-":
+		return 5
+	case "*", "/", "%":
+		return 6
+	}
+	return 0
+}
+
+// isAssignmentOperator checks if op assigns to its left operand
+func isAssignmentOperator(op string) bool {
+	switch op {
+	case "=", "+=", "-=", "*=", "/=", "%=":
+		return true
+	}
+	return false
+}
+
 // parsePrimary parses primary expressions (literals, identifiers)
 func (p *Parser) parsePrimary() *ASTNode {
 	token := p.tokenizer.GetCurrentToken()
@@ -509,33 +1060,37 @@ func (p *Parser) parsePrimary() *ASTNode {
 		return &ASTNode{
 			Type:  LiteralD,
 			Value: p.consume().Value,
+			Span:  p.spanFrom(token.Pos()),
 		}
 	case StringLiteral:
 		return &ASTNode{
 			Type:  LiteralD,
 			Value: p.consume().Value,
+			Span:  p.spanFrom(token.Pos()),
 		}
 	case Identifier:
 		return &ASTNode{
 			Type:  IdentifierD,
 			Value: p.consume().Value,
+			Span:  p.spanFrom(token.Pos()),
 		}
 	case Keyword:
 		if IsAllowedKeyAsVal(token.Value) {
 			return &ASTNode{
 				Type:  LiteralD,
 				Value: p.consume().Value,
+				Span:  p.spanFrom(token.Pos()),
 			}
 		}
 	}
 
-	p.addError(fmt.Sprintf("Unexpected token: %s", token.Value))
+	p.addError(codeUnexpectedToken, fmt.Sprintf("Unexpected token: %s", token.describe()))
 	return nil
 }
 
 // parseParenExpr parses parenthesized expressions
 func (p *Parser) parseParenExpr() *ASTNode {
-	p.consume() // consume '('
+	start := p.consume().Pos() // consume '('
 
 	expr := p.parseExpression()
 	if expr == nil {
@@ -543,7 +1098,7 @@ func (p *Parser) parseParenExpr() *ASTNode {
 	}
 
 	if !p.expectTokenVal(")") {
-		p.addError("Expected ')' after expression")
+		p.addUnclosedError(")", "Expected ')' after expression")
 		return nil
 	}
 	p.consume() // consume ')'
@@ -551,35 +1106,78 @@ func (p *Parser) parseParenExpr() *ASTNode {
 	return &ASTNode{
 		Type:  Expression,
 		Paren: expr,
+		Span:  p.spanFrom(start),
+	}
+}
+
+// parseAwait parses await expressions. A trailing '?' applies to the awaited
+// value, so await fetchUser(id)? unwraps the result the promise resolves to.
+func (p *Parser) parseAwait() *ASTNode {
+	if p.funcDepth == 0 {
+		p.addError(codeOutsideFunction, fmt.Sprintf("'%s' can only be used inside a function", spell("await")))
+	}
+	start := p.consume().Pos() // consume 'await'
+
+	operand := p.parseOperand()
+	if operand == nil {
+		p.addError(codeUnexpectedToken, fmt.Sprintf("Expected value after '%s'", spell("await")))
+		return nil
+	}
+
+	if operand.Type == TryExpression {
+		return &ASTNode{
+			Type: TryExpression,
+			Left: &ASTNode{Type: AwaitExpression, Left: operand.Left, Span: Span{Start: start, End: operand.Left.Span.End}},
+			Span: p.spanFrom(start),
+		}
+	}
+	return &ASTNode{
+		Type: AwaitExpression,
+		Left: operand,
+		Span: p.spanFrom(start),
 	}
 }
 
 // parseNotMinusExpression parses unary expressions (! and -)
 func (p *Parser) parseNotMinusExpression() *ASTNode {
-	operator := p.consume().Value // Consume the unary operator
+	operatorToken := p.consume() // Consume the unary operator
+	operator := operatorToken.Value
 
-	var operand *ASTNode
-	if p.expectTokenVal("(") {
-		operand = p.parseParenExpr()
-	} else {
-		operand = p.parseExpression()
-	}
+	operand := p.parseOperand()
 
 	return &ASTNode{
 		Type:     UnaryExpression,
 		Operator: operator,
 		Left:     operand,
+		Span:     p.spanFrom(operatorToken.Pos()),
 	}
 }
 
 // parseCallExpr parses function call expressions
 func (p *Parser) parseCallExpr() *ASTNode {
-	identifier := p.consume().Value // Consume the function identifier
+	callee := p.consume() // Consume the function identifier
+	identifier := callee.Value
 
 	if !p.expectTokenVal("(") {
-		p.addError(fmt.Sprintf("Expected '(' after function identifier '%s'", identifier))
+		p.addError(codeCallSyntax, fmt.Sprintf("Expected '(' after function identifier '%s'", callee.Spelling()))
 		return nil
 	}
+
+	args, ok := p.parseArgs(callee.Spelling())
+	if !ok {
+		return nil
+	}
+
+	return &ASTNode{
+		Type:       CallExpression,
+		Identifier: identifier,
+		Args:       args,
+		Span:       p.spanFrom(callee.Pos()),
+	}
+}
+
+// parseArgs parses a parenthesized argument list for the call named name
+func (p *Parser) parseArgs(name string) ([]ASTNode, bool) {
 	p.consume() // consume '('
 
 	var args []ASTNode
@@ -587,46 +1185,174 @@ func (p *Parser) parseCallExpr() *ASTNode {
 	// Check for empty argument list
 	if p.expectTokenVal(")") {
 		p.consume() // consume ')'
-		return &ASTNode{
-			Type:       CallExpression,
-			Identifier: identifier,
-			Args:       args,
-		}
+		return args, true
 	}
 
 	// Parse arguments
 	for !p.expectTokenVal(")") && p.tokenizer.GetCurrentToken().Type != EOF {
+		// name: value passes an argument by parameter name
+		var argName Token
+		if p.expectToken(Identifier) && p.expectPeekVal(":") {
+			argName = p.consume()
+			p.consume() // consume ':'
+		}
+
 		arg := p.parseExpression()
 		if arg == nil {
-			p.addError(fmt.Sprintf("Invalid argument in function call '%s'", identifier))
+			p.addError(codeCallSyntax, fmt.Sprintf("Invalid argument in function call '%s'", name))
 			break
 		}
+		if argName.Value != "" {
+			arg = &ASTNode{
+				Type:        NamedArg,
+				Name:        argName.Value,
+				Initializer: arg,
+				Span:        p.spanFrom(argName.Pos()),
+			}
+		}
 		args = append(args, *arg)
 
 		if p.expectTokenVal(",") {
 			p.consume() // consume ','
 		} else if !p.expectTokenVal(")") {
-			p.addError(fmt.Sprintf("Expected ',' or ')' in function call '%s'", identifier))
+			p.addError(codeCallSyntax, fmt.Sprintf("Expected ',' or ')' in function call '%s'", name))
 			break
 		}
 	}
 
 	if !p.expectTokenVal(")") {
-		p.addError(fmt.Sprintf("Unmatched parentheses in function call '%s'", identifier))
-		return nil
+		p.addUnclosedError(")", fmt.Sprintf("Unmatched parentheses in function call '%s'", name))
+		return nil, false
 	}
 	p.consume() // consume ')'
 
-	return &ASTNode{
-		Type:       CallExpression,
-		Identifier: identifier,
-		Args:       args,
+	return args, true
+}
+
+// parsePostfix parses member access, method calls and indexing that follow an
+// expression: obj.name, obj.name(args), expr[i]
+func (p *Parser) parsePostfix(left *ASTNode) *ASTNode {
+	for left != nil {
+		if p.expectTokenVal(".") {
+			p.consume() // consume '.'
+			if !p.expectToken(Identifier) && !p.expectToken(Keyword) {
+				p.addError(codeMemberSyntax, "Expected property name after '.'")
+				return nil
+			}
+			// Property names keep the spelling used, but a method named
+			// after a built-in in the keyword pack calls that built-in
+			name := p.consume()
+			method := name.Spelling()
+			if name.Type == Identifier {
+				method = name.Value
+			}
+
+			if p.expectTokenVal("(") {
+				args, ok := p.parseArgs(name.Spelling())
+				if !ok {
+					return nil
+				}
+				left = &ASTNode{
+					Type:       CallExpression,
+					Identifier: method,
+					Left:       left,
+					Args:       args,
+					Span:       p.spanFrom(left.Span.Start),
+				}
+			} else {
+				left = &ASTNode{
+					Type:       MemberExpression,
+					Identifier: name.Spelling(),
+					Left:       left,
+					Span:       p.spanFrom(left.Span.Start),
+				}
+			}
+		} else if p.expectTokenVal("-") && p.expectPeekVal(">") &&
+			p.tokenizer.Peek(0).Offset == p.tokenizer.GetCurrentToken().End.Offset {
+			// recv->name(args) calls recv's own method, even when an AY
+			// built-in has the same name
+			p.consume() // consume '-'
+			p.consume() // consume '>'
+			if !p.expectToken(Identifier) && !p.expectToken(Keyword) {
+				p.addError(codeMemberSyntax, "Expected method name after '->'")
+				return nil
+			}
+			name := p.consume()
+			if !p.expectTokenVal("(") {
+				p.addError(codeMemberSyntax, fmt.Sprintf("Expected '(' after '->%s'", name.Spelling()))
+				return nil
+			}
+			args, ok := p.parseArgs(name.Spelling())
+			if !ok {
+				return nil
+			}
+			left = &ASTNode{
+				Type:       CallExpression,
+				Identifier: name.Spelling(),
+				Operator:   "->",
+				Left:       left,
+				Args:       args,
+				Span:       p.spanFrom(left.Span.Start),
+			}
+		} else if p.expectTokenVal("?") {
+			// value? unwraps an ok result or returns an err result early
+			if p.funcDepth == 0 {
+				p.addError(codeOutsideFunction, "'?' can only be used inside a function")
+			}
+			p.consume() // consume '?'
+			left = &ASTNode{
+				Type: TryExpression,
+				Left: left,
+				Span: p.spanFrom(left.Span.Start),
+			}
+		} else if p.expectTokenVal("with") && p.expectPeekVal("{") {
+			// p with {x: 3} copies p with some fields changed
+			p.consume() // consume 'with'
+			changes := p.parseObject()
+			if changes == nil {
+				return nil
+			}
+			if changes.Type != ObjectExpr {
+				p.addError(codeMemberSyntax, fmt.Sprintf("Expected fields to change after '%s'", spell("with")))
+				return nil
+			}
+			left = &ASTNode{
+				Type:  WithExpression,
+				Left:  left,
+				Right: changes,
+				Span:  p.spanFrom(left.Span.Start),
+			}
+		} else if p.expectTokenVal("[") {
+			var indexNodes []ASTNode
+			for p.expectTokenVal("[") {
+				p.consume() // consume '['
+				index := p.parseIndex("expression")
+				if index == nil {
+					return nil
+				}
+				indexNodes = append(indexNodes, *index)
+				if !p.expectTokenVal("]") {
+					p.addUnclosedError("]", "Expected ']' after index")
+					return nil
+				}
+				p.consume() // consume ']'
+			}
+			left = &ASTNode{
+				Type:  ArrayIndex,
+				Left:  left,
+				Index: indexNodes,
+				Span:  p.spanFrom(left.Span.Start),
+			}
+		} else {
+			return left
+		}
 	}
+	return left
 }
 
 // parseArray parses array expressions
 func (p *Parser) parseArray() *ASTNode {
-	p.consume() // consume '['
+	start := p.consume().Pos() // consume '['
 
 	var elements []ASTNode
 
@@ -635,6 +1361,7 @@ func (p *Parser) parseArray() *ASTNode {
 		return &ASTNode{
 			Type:     ArrayExpr,
 			Elements: elements,
+			Span:     p.spanFrom(start),
 		}
 	}
 
@@ -647,21 +1374,29 @@ func (p *Parser) parseArray() *ASTNode {
 
 		element := p.parseExpression()
 		if element == nil {
-			p.addError("Invalid array element")
+			p.addError(codeArraySyntax, "Invalid array element")
 			break
 		}
+
+		// [expr for x in xs if cond]
+		if len(elements) == 0 {
+			p.skipNewLines()
+			if p.expectTokenVal("for") {
+				return p.parseComprehension(&ASTNode{Type: ListComprehension, Initializer: element, Span: Span{Start: start}}, "]")
+			}
+		}
 		elements = append(elements, *element)
 
 		if p.expectTokenVal(",") {
 			p.consume() // consume ','
 		} else if !p.expectTokenVal("]") {
-			p.addError("Expected ',' or ']' in array")
+			p.addError(codeArraySyntax, "Expected ',' or ']' in array")
 			break
 		}
 	}
 
 	if !p.expectTokenVal("]") {
-		p.addError("Unmatched brackets in array")
+		p.addUnclosedError("]", "Unmatched brackets in array")
 		return nil
 	}
 	p.consume() // consume ']'
@@ -669,33 +1404,187 @@ func (p *Parser) parseArray() *ASTNode {
 	return &ASTNode{
 		Type:     ArrayExpr,
 		Elements: elements,
+		Span:     p.spanFrom(start),
+	}
+}
+
+// parseObject parses object literals ({a: 1, "b c": 2, name}) and map
+// comprehensions ({k: v for k, v in pairs})
+func (p *Parser) parseObject() *ASTNode {
+	start := p.consume().Pos() // consume '{'
+
+	var props []ASTNode
+	for {
+		p.skipNewLines()
+		if p.expectTokenVal("}") || p.expectToken(EOF) {
+			break
+		}
+
+		keyToken := p.tokenizer.GetCurrentToken()
+		key := p.parseBinaryExpression()
+		if key == nil {
+			p.addError(codeObjectSyntax, "Invalid object key")
+			return nil
+		}
+
+		// Shorthand {name} stands for {name: name}
+		if key.Type == IdentifierD && (p.expectTokenVal(",") || p.expectTokenVal("}") || p.expectToken(NewLine)) {
+			props = append(props, ASTNode{Type: Property, Name: keyToken.Spelling(), Initializer: key, Span: key.Span})
+		} else {
+			if !p.expectTokenVal(":") {
+				p.addError(codeObjectSyntax, "Expected ':' after object key")
+				return nil
+			}
+			p.consume() // consume ':'
+			p.skipNewLines()
+
+			value := p.parseExpression()
+			if value == nil {
+				p.addError(codeObjectSyntax, "Invalid object value")
+				return nil
+			}
+
+			p.skipNewLines()
+			if len(props) == 0 && p.expectTokenVal("for") {
+				return p.parseComprehension(&ASTNode{Type: MapComprehension, Left: key, Right: value, Span: Span{Start: start}}, "}")
+			}
+
+			name, ok := propertyName(*key)
+			if key.Type == IdentifierD {
+				name = keyToken.Spelling()
+			}
+			if !ok {
+				p.addErrorAt(keyToken, codeObjectSyntax, "Object keys must be names, strings or numbers")
+				return nil
+			}
+			props = append(props, ASTNode{Type: Property, Name: name, Initializer: value, Span: Span{Start: key.Span.Start, End: value.Span.End}})
+		}
+
+		p.skipNewLines()
+		if p.expectTokenVal(",") {
+			p.consume() // consume ','
+		} else if !p.expectTokenVal("}") {
+			p.addError(codeObjectSyntax, "Expected ',' or '}' in object")
+			return nil
+		}
+	}
+
+	if !p.expectTokenVal("}") {
+		p.addUnclosedError("}", "Unmatched braces in object")
+		return nil
+	}
+	p.consume() // consume '}'
+
+	return &ASTNode{
+		Type:     ObjectExpr,
+		Elements: props,
+		Span:     p.spanFrom(start),
+	}
+}
+
+// propertyName returns the key an object literal entry names
+func propertyName(key ASTNode) (string, bool) {
+	switch key.Type {
+	case IdentifierD:
+		return key.Value, true
+	case LiteralD:
+		if strings.HasPrefix(key.Value, "\"") || strings.HasPrefix(key.Value, "'") {
+			return key.Value[1:], true
+		}
+		if key.Value != "" && key.Value[0] >= '0' && key.Value[0] <= '9' {
+			return key.Value, true
+		}
+	}
+	return "", false
+}
+
+// parseComprehension parses the for/if clauses of a comprehension up to the
+// closing bracket. node already holds the element (or key and value) and
+// where it starts.
+func (p *Parser) parseComprehension(node *ASTNode, closing string) *ASTNode {
+	for {
+		p.skipNewLines()
+
+		if p.expectTokenVal("for") {
+			clauseStart := p.consume().Pos() // consume 'for'
+			var targets []ASTNode
+			for p.expectToken(Identifier) {
+				target := p.consume()
+				targets = append(targets, ASTNode{Type: IdentifierD, Value: target.Value, Span: p.spanFrom(target.Pos())})
+				if !p.expectTokenVal(",") {
+					break
+				}
+				p.consume() // consume ','
+			}
+			if len(targets) == 0 {
+				p.addError(codeComprehension, fmt.Sprintf("Expected loop variable after '%s'", spell("for")))
+				return nil
+			}
+			if !p.expectTokenVal("in") {
+				p.addError(codeComprehension, fmt.Sprintf("Expected '%s' after comprehension variables", spell("in")))
+				return nil
+			}
+			p.consume() // consume 'in'
+
+			iterable := p.parseExpression()
+			if iterable == nil {
+				p.addError(codeComprehension, "Expected expression to iterate over")
+				return nil
+			}
+			node.Body = append(node.Body, ASTNode{Type: CompFor, Params: targets, Right: iterable, Span: p.spanFrom(clauseStart)})
+		} else if p.expectTokenVal("if") {
+			clauseStart := p.consume().Pos() // consume 'if'
+			test := p.parseExpression()
+			if test == nil {
+				p.addError(codeComprehension, fmt.Sprintf("Expected condition after '%s'", spell("if")))
+				return nil
+			}
+			node.Body = append(node.Body, ASTNode{Type: CompIf, Test: test, Span: p.spanFrom(clauseStart)})
+		} else {
+			break
+		}
+	}
+
+	if !p.expectTokenVal(closing) {
+		p.addUnclosedError(closing, fmt.Sprintf("Expected '%s' to close comprehension", closing))
+		return nil
+	}
+	p.consume() // consume closing bracket
+	node.Span = p.spanFrom(node.Span.Start)
+	return node
+}
+
+// skipNewLines skips line breaks inside bracketed constructs
+func (p *Parser) skipNewLines() {
+	for p.expectToken(NewLine) {
+		p.tokenizer.Next()
 	}
 }
 
 // parseArrIndex parses array index expressions
 func (p *Parser) parseArrIndex() *ASTNode {
-	identifier := p.consume().Value // Consume the array identifier
+	identifierToken := p.consume() // Consume the array identifier
+	identifier := identifierToken.Value
 
 	if !p.expectTokenVal("[") {
-		p.addError(fmt.Sprintf("Expected '[' after array identifier '%s'", identifier))
+		p.addError(codeIndexSyntax, fmt.Sprintf("Expected '[' after array identifier '%s'", identifier))
 		return nil
 	}
 
 	var indexNodes []ASTNode
 
-	// Handle multiple nested indices like ident[0][1][2]
+	// Handle multiple nested indices like ident[0][1][2] and slices like ident[1:3]
 	for p.expectTokenVal("[") {
 		p.consume() // consume '['
 
-		index := p.parseExpression()
+		index := p.parseIndex(identifier)
 		if index == nil {
-			p.addError(fmt.Sprintf("Invalid array index for '%s'", identifier))
 			return nil
 		}
 		indexNodes = append(indexNodes, *index)
 
 		if !p.expectTokenVal("]") {
-			p.addError(fmt.Sprintf("Expected ']' after array index for '%s'", identifier))
+			p.addUnclosedError("]", fmt.Sprintf("Expected ']' after array index for '%s'", identifier))
 			return nil
 		}
 		p.consume() // consume ']'
@@ -705,11 +1594,52 @@ func (p *Parser) parseArrIndex() *ASTNode {
 		Type:       ArrayIndex,
 		Identifier: identifier,
 		Index:      indexNodes,
+		Span:       p.spanFrom(identifierToken.Pos()),
+	}
+}
+
+// parseIndex parses what is between the brackets of an index: a single expression
+// or a slice [low:high:step] where every part is optional
+func (p *Parser) parseIndex(identifier string) *ASTNode {
+	start := p.here()
+	var low *ASTNode
+	if !p.expectTokenVal(":") {
+		low = p.parseExpression()
+		if low == nil {
+			p.addError(codeIndexSyntax, fmt.Sprintf("Invalid array index for '%s'", identifier))
+			return nil
+		}
+		if !p.expectTokenVal(":") {
+			return low
+		}
+	}
+
+	slice := &ASTNode{Type: SliceExpr, Low: low}
+	p.consume() // consume ':'
+	if !p.expectTokenVal(":") && !p.expectTokenVal("]") {
+		slice.High = p.parseExpression()
+		if slice.High == nil {
+			p.addError(codeIndexSyntax, fmt.Sprintf("Invalid slice end for '%s'", identifier))
+			return nil
+		}
+	}
+	if p.expectTokenVal(":") {
+		p.consume() // consume ':'
+		if !p.expectTokenVal("]") {
+			slice.Step = p.parseExpression()
+			if slice.Step == nil {
+				p.addError(codeIndexSyntax, fmt.Sprintf("Invalid slice step for '%s'", identifier))
+				return nil
+			}
+		}
 	}
+	slice.Span = p.spanFrom(start)
+	return slice
 }
 
 // parseIncDec parses increment/decrement expressions
 func (p *Parser) parseIncDec() *ASTNode {
+	start := p.here()
 	if p.expectToken(Operator) && p.expectPeek(Identifier) {
 		// Prefix: ++identifier or --identifier
 		infixOp := p.consume().Value
@@ -718,6 +1648,7 @@ func (p *Parser) parseIncDec() *ASTNode {
 			Type:       IncDec,
 			InfixOp:    infixOp,
 			Identifier: identifier,
+			Span:       p.spanFrom(start),
 		}
 	} else {
 		// Postfix: identifier++ or identifier--
@@ -727,16 +1658,17 @@ func (p *Parser) parseIncDec() *ASTNode {
 			Type:       IncDec,
 			PostOp:     postOp,
 			Identifier: identifier,
+			Span:       p.spanFrom(start),
 		}
 	}
 }
 
 // parseIfElse parses if-else statements
 func (p *Parser) parseIfElse() *ASTNode {
-	p.consume() // consume 'if'
+	start := p.consume().Pos() // consume 'if'
 
 	if !p.expectTokenVal("(") {
-		p.addError("Expected '(' after 'if'")
+		p.addError(codeIfSyntax, fmt.Sprintf("Expected '(' after '%s'", spell("if")))
 		return nil
 	}
 	p.consume() // consume '('
@@ -747,7 +1679,7 @@ func (p *Parser) parseIfElse() *ASTNode {
 	}
 
 	if !p.expectTokenVal(")") {
-		p.addError("Expected ')' after if condition")
+		p.addUnclosedError(")", fmt.Sprintf("Expected ')' after %s condition", spell("if")))
 		return nil
 	}
 	p.consume() // consume ')'
@@ -775,15 +1707,17 @@ func (p *Parser) parseIfElse() *ASTNode {
 		Test:       test,
 		Consequent: consequent,
 		Alternate:  alternate,
+		Span:       p.spanFrom(start),
 	}
 }
 
 // parseLoop parses for and while loops
 func (p *Parser) parseLoop() *ASTNode {
-	loopType := p.consume().Value // consume 'for' or 'while'
+	loopToken := p.consume() // consume 'for' or 'while'
+	loopType := loopToken.Value
 
 	if !p.expectTokenVal("(") {
-		p.addError(fmt.Sprintf("Expected '(' after '%s'", loopType))
+		p.addError(codeLoopSyntax, fmt.Sprintf("Expected '(' after '%s'", spell(loopType)))
 		return nil
 	}
 	p.consume() // consume '('
@@ -800,7 +1734,7 @@ func (p *Parser) parseLoop() *ASTNode {
 		}
 
 		if !p.expectTokenVal(";") {
-			p.addError("Expected ';' after for loop initializer")
+			p.addError(codeLoopSyntax, fmt.Sprintf("Expected ';' after %s loop initializer", spell("for")))
 			return nil
 		}
 		p.consume() // consume ';'
@@ -808,7 +1742,7 @@ func (p *Parser) parseLoop() *ASTNode {
 		test := p.parseExpression()
 
 		if !p.expectTokenVal(";") {
-			p.addError("Expected ';' after for loop test")
+			p.addError(codeLoopSyntax, fmt.Sprintf("Expected ';' after %s loop test", spell("for")))
 			return nil
 		}
 		p.consume() // consume ';'
@@ -816,7 +1750,7 @@ func (p *Parser) parseLoop() *ASTNode {
 		upgrade := p.parseExpression()
 
 		if !p.expectTokenVal(")") {
-			p.addError("Expected ')' after for loop")
+			p.addUnclosedError(")", fmt.Sprintf("Expected ')' after %s loop", spell("for")))
 			return nil
 		}
 		p.consume() // consume ')'
@@ -832,13 +1766,14 @@ func (p *Parser) parseLoop() *ASTNode {
 			Test:        test,
 			Upgrade:     upgrade,
 			Body:        body.Body,
+			Span:        p.spanFrom(loopToken.Pos()),
 		}
 	} else {
 		// While loop: while (test)
 		test := p.parseExpression()
 
 		if !p.expectTokenVal(")") {
-			p.addError("Expected ')' after while condition")
+			p.addUnclosedError(")", fmt.Sprintf("Expected ')' after %s condition", spell("while")))
 			return nil
 		}
 		p.consume() // consume ')'
@@ -852,6 +1787,7 @@ func (p *Parser) parseLoop() *ASTNode {
 			Type: Loop,
 			Test: test,
 			Body: body.Body,
+			Span: p.spanFrom(loopToken.Pos()),
 		}
 	}
 }
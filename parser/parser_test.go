@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// grouping writes an expression with every binary and unary operation in
+// parentheses, to show how the parser grouped it
+func grouping(node *ASTNode) string {
+	switch node.Type {
+	case BinaryExpression:
+		return "(" + grouping(node.Left) + " " + node.Operator + " " + grouping(node.Right) + ")"
+	case UnaryExpression:
+		return "(" + node.Operator + grouping(node.Left) + ")"
+	case Expression:
+		return grouping(node.Paren)
+	}
+	return node.Value
+}
+
+func TestBinaryPrecedence(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"1 + 2 * 3", "(1 + (2 * 3))"},
+		{"1 * 2 + 3", "((1 * 2) + 3)"},
+		{"10 - 3 - 2", "((10 - 3) - 2)"},
+		{"8 / 4 / 2", "((8 / 4) / 2)"},
+		{"1 + 2 * 3 % 4 - 5", "((1 + ((2 * 3) % 4)) - 5)"},
+		{"a < b == c > d", "((a < b) == (c > d))"},
+		{"a == b && c != d", "((a == b) && (c != d))"},
+		{"a || b && c || d", "((a || (b && c)) || d)"},
+		{"a + b <= c * d", "((a + b) <= (c * d))"},
+		{"l v = (1 + 2) * 3", "((1 + 2) * 3)"},
+		{"l v = -a * b", "((-a) * b)"},
+		{"l v = !a && b", "((!a) && b)"},
+		{"x = y = 1 + 2 * 3", "(x = (y = (1 + (2 * 3))))"},
+		{"x += a || b", "(x += (a || b))"},
+	}
+	for _, test := range tests {
+		p := NewParser(test.src + "\n")
+		p.Start()
+		if len(p.Errors) > 0 || len(p.Nodes) != 1 {
+			t.Errorf("%s: got %d nodes and errors %v", test.src, len(p.Nodes), p.Errors)
+			continue
+		}
+		node := &p.Nodes[0]
+		if node.Type == VariableDeclaration {
+			node = node.Initializer
+		}
+		if got := grouping(node); got != test.want {
+			t.Errorf("%s groups as %s, want %s", test.src, got, test.want)
+		}
+	}
+}
+
+func TestBinaryPrecedenceRuns(t *testing.T) {
+	src := strings.Join([]string{
+		"print(10 - 3 - 2)",
+		"print(2 + 3 * 4)",
+		"print(1 + 2 * 3 == 7)",
+		"print(!false && false)",
+		"print(100 / 10 / 5)",
+	}, "\n")
+	if got, want := runProgram(t, src), "5\n14\ntrue\nfalse\n2\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
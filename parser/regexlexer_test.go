@@ -0,0 +1,281 @@
+package parser
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+// regexTest is the old lexer's testRegex
+func regexTest(p, s string) bool {
+	re, er := regexp.Compile(p)
+	if er != nil {
+		log.Fatal("Unexpected regex error: ", er)
+	}
+	test := re.MatchString(s)
+
+	return test
+}
+
+// regexTokenize is the regex-based Tokenize that the hand-written lexer
+// replaced, kept unchanged apart from its names so the golden token streams in
+// testdata/lexer can be regenerated from it and BenchmarkRegexTokenize can
+// measure it. Its positions are not used: it put tokens after a string, an
+// inline comment or whitespace ending a line in the wrong column, so
+// oldTokens places each token where its text is in the source.
+//
+// The lexer deliberately differs from it on input outside testdata/lexer:
+//   - identifiers can contain Unicode letters and digits, not only ASCII
+//   - a run of operator characters that isn't AY operators, such as === or
+//     **, is one Unknown token reported as AY0005, where this split it up
+//   - an unterminated string ends at the end of its line instead of taking
+//     the next line with it, and it is reported, as are unterminated
+//     comments and unexpected characters
+//   - tokens carry byte offsets and end positions, and with trivia kept, the
+//     whitespace and comments this dropped
+func regexTokenize(line string) []Token {
+	var tokens []Token
+	var currentToken string
+	var currentType int
+	var sOpen bool
+	var qChar string
+
+	for i := 0; i < len(line); i++ {
+		char := string(line[i])
+		var nextChar string
+		if i+1 < len(line) {
+			nextChar = string(line[i+1])
+		}
+
+		// multi line comment start
+		if i+1 < len(line) && char == "/" && nextChar == "*" && currentType != SingleLineComment && !sOpen {
+			currentType = MultiLineComment
+			currentToken = "/*"
+			continue
+
+		}
+		if i+1 < len(line) && char == "*" && nextChar == "/" && currentType == MultiLineComment && !sOpen {
+			currentToken += "*/"
+			tokens = append(tokens, Token{Type: currentType, Value: currentToken})
+			i++
+			currentToken = ""
+			currentType = Identifier
+			continue
+		}
+
+		// New lines
+		if i+1 < len(line) && (char == "\r" && nextChar == "\n") && currentType != MultiLineComment {
+			if currentType == SingleLineComment {
+				tokens = append(tokens, Token{Type: currentType, Value: currentToken})
+			}
+			tokens = append(tokens, Token{Type: NewLine, Value: "\r\n"})
+			i++
+			currentToken = ""
+			currentType = Identifier
+			continue
+		} else if char == "\n" && currentType != MultiLineComment {
+			if currentType == SingleLineComment {
+				tokens = append(tokens, Token{Type: currentType, Value: currentToken})
+			}
+			tokens = append(tokens, Token{Type: NewLine, Value: "\n"})
+			currentToken = ""
+			currentType = Identifier
+			continue
+		}
+
+		// this checks if it's a string quote character, controls the value of sOpen
+		// notice how we also make sure we are not in a comment by checking the type
+		if (char == string('"') || char == "'") && currentType != SingleLineComment && currentType != MultiLineComment {
+			qChar = char
+			if sOpen {
+				// extra validation to make sure it's the proper end to the string
+				if len(currentToken) > 0 && string(currentToken[0]) == qChar {
+					currentToken += qChar
+					// Remove quotes from the final token value
+					stringValue := currentToken[1 : len(currentToken)-1] // Remove first and last char (quotes)
+					tokens = append(tokens, Token{Type: currentType, Value: stringValue})
+					// cleanup
+					currentToken = ""
+					sOpen = false
+					currentType = Identifier
+				}
+			} else {
+				currentType = StringLiteral
+				sOpen = true
+				currentToken = char // Start with the opening quote
+			}
+		}
+
+		// keep adding every character as a comment, but since we only expect a line this is fine as it continues to the end of the line
+		//keep adding string characters until sOpen is false, i.e it's closed with the ending quotechar
+		if sOpen || currentType == SingleLineComment || currentType == MultiLineComment {
+			currentToken += char
+			continue
+		}
+
+		identTest := regexTest(`[a-zA-Z_@]`, char)
+		opTest := regexTest(`[+*/%=<>&|!?^-]`, char)
+		litTest := regexTest(`\d`, char)
+		punctTest := regexTest(`[(){}[\]:;,.#]`, char)
+
+		if identTest && !sOpen && currentType != SingleLineComment && currentType != MultiLineComment {
+			if currentType == Identifier {
+				currentToken += char
+			} else {
+				currentType = Identifier
+				currentToken = char
+			}
+			//checks if it's the last character or not, passes if not last char
+			if i+1 < len(line) {
+				if !regexTest(`[a-zA-Z_@0-9]`, string(line[i+1])) {
+					tokens = append(tokens, wordToken(currentToken))
+					currentToken = ""
+				}
+			}
+		} else if regexTest(`\s`, char) && !sOpen && currentType != SingleLineComment && currentType != MultiLineComment {
+			currentType = Whitespace
+			if len(currentToken) > 0 && regexTest(`\s`, currentToken) {
+				currentToken += char
+			} else {
+				currentToken = char
+			}
+
+			if i+1 < len(line) {
+				if !regexTest(`\s`, string(line[i+1])) {
+					tokens = append(tokens, Token{Type: currentType, Value: currentToken})
+					currentToken = ""
+				}
+			}
+		} else if opTest && !sOpen && currentType != SingleLineComment && currentType != MultiLineComment {
+			currentType = Operator
+			if len(currentToken) > 0 && regexTest(`[+*/%=<>&|!?^-]`, currentToken) {
+				switch len(currentToken) {
+				case 1:
+					if currentToken == "/" && char == "/" {
+						// This is a single line comment //
+						currentType = SingleLineComment
+						currentToken += char
+					} else if (currentToken == "=" && char == "=") || (currentToken == "!" && char == "=") ||
+						(currentToken == "<" && char == "=") || (currentToken == ">" && char == "=") ||
+						(currentToken == "&" && char == "&") || (currentToken == "|" && char == "|") ||
+						(currentToken == "+" && char == "+") || (currentToken == "-" && char == "-") ||
+						(currentToken == "+" && char == "=") || (currentToken == "-" && char == "=") ||
+						(currentToken == "*" && char == "=") || (currentToken == "/" && char == "=") ||
+						(currentToken == "%" && char == "=") || (currentToken == "|" && char == ">") ||
+						(currentToken == "=" && char == ">") {
+						currentToken += char
+						tokens = append(tokens, Token{Type: currentType, Value: currentToken})
+						currentToken = ""
+					} else {
+						tokens = append(tokens, Token{Type: currentType, Value: currentToken})
+						currentToken = char
+					}
+				case 2:
+					if (currentToken == ">>" || currentToken == "<<") && (char == ">" || char == "<") {
+						currentToken += char
+						tokens = append(tokens, Token{Type: currentType, Value: currentToken})
+						currentToken = ""
+					} else {
+						// For 2-character operators like <=, >=, ==, !=, etc., push the token and start new one
+						tokens = append(tokens, Token{Type: currentType, Value: currentToken})
+						currentToken = char
+					}
+				default:
+					tokens = append(tokens, Token{Type: Unknown, Value: currentToken})
+					currentToken = char
+				}
+			} else {
+				currentToken = char
+			}
+
+			if i+1 < len(line) && currentType != SingleLineComment && currentType != MultiLineComment {
+				if !regexTest(`[+*/%=<>&|!?^-]`, string(line[i+1])) {
+					if currentToken != "" {
+						tokens = append(tokens, Token{Type: currentType, Value: currentToken})
+					}
+					currentToken = ""
+				}
+			}
+		} else if litTest && !sOpen && currentType != SingleLineComment && currentType != MultiLineComment {
+			// If we're already building an identifier, add the digit to it
+			if currentType == Identifier {
+				currentToken += char
+				// check if next char would end the identifier
+				if i+1 < len(line) {
+					if !regexTest(`[a-zA-Z_@0-9]`, nextChar) {
+						tokens = append(tokens, wordToken(currentToken))
+						currentToken = ""
+					}
+				}
+			} else {
+				currentType = Literal
+				if len(currentToken) > 0 && (regexTest(`\d`, currentToken) || strings.HasSuffix(currentToken, ".")) {
+					if regexTest(`\d`, currentToken) || strings.HasSuffix(currentToken, ".") {
+						currentToken += char
+					}
+				} else {
+					currentToken = char
+				}
+				if i+1 < len(line) {
+					if !regexTest(`\d`, nextChar) && nextChar != "." {
+						tokens = append(tokens, Token{Type: currentType, Value: currentToken})
+						currentToken = ""
+					}
+				}
+			}
+		} else if punctTest && !sOpen && currentType != SingleLineComment && currentType != MultiLineComment {
+			if currentType == Literal && char == "." && !strings.Contains(currentToken, ".") && len(currentToken) > 0 {
+				currentToken += char
+			} else {
+				currentType = Punctuation
+				currentToken = char
+				tokens = append(tokens, Token{Type: currentType, Value: currentToken})
+				currentToken = ""
+			}
+		}
+	}
+
+	// Handle any remaining token at the end
+	if currentToken != "" {
+		if currentType == Identifier {
+			tokens = append(tokens, wordToken(currentToken))
+		} else {
+			tokens = append(tokens, Token{Type: currentType, Value: currentToken})
+		}
+	}
+
+	// Add EOF token
+	tokens = append(tokens, Token{Type: EOF, Value: ""})
+	lineNo, colNo := 1, 1
+	strSplit := regexp.MustCompile(`\r\n|\n`)
+	for i, token := range tokens {
+		tokens[i].Line = lineNo
+		tokens[i].Col = colNo
+
+		// Handle multi-line comments and strings that contain newlines
+		if strings.Contains(token.Value, "\n") || strings.Contains(token.Value, "\r\n") {
+			lines := strSplit.Split(token.Value, -1)
+
+			lineNo += len(lines) - 1
+			if len(lines) > 1 {
+				colNo = len(lines[len(lines)-1]) + 1
+			} else {
+				colNo += len(lines[0])
+			}
+		} else if token.Type == NewLine {
+			lineNo++
+			colNo = 1
+		} else {
+			colNo += len(token.Spelling())
+		}
+	}
+	// Filter out whitespace and comment tokens
+	var filteredTokens []Token
+	for _, token := range tokens {
+		if token.Type != Whitespace && token.Type != SingleLineComment && token.Type != MultiLineComment {
+			filteredTokens = append(filteredTokens, token)
+		}
+	}
+
+	return filteredTokens
+}
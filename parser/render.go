@@ -0,0 +1,330 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Renderer writes diagnostics for one source file
+type Renderer interface {
+	Render(w io.Writer, diagnostics []Diagnostic) error
+}
+
+// Lines of source shown around the ones a diagnostic points at, and how many
+// lines at each end of a long span are shown
+const (
+	contextBefore = 2
+	contextAfter  = 1
+	spanEdgeLines = 2
+)
+
+// tabWidth is how many columns a tab is shown as. Tabs in source lines are
+// written as spaces, so underlines line up whatever the terminal's tab stops.
+const tabWidth = 4
+
+// displayLine returns a source line as it is shown
+func displayLine(line string) string {
+	return strings.ReplaceAll(line, "\t", strings.Repeat(" ", tabWidth))
+}
+
+// displayCol returns the column on screen of rune column col of line, once
+// tabs are expanded and wide characters take two columns. Columns past the
+// end of the line, such as the one just after it, take one each.
+func displayCol(line string, col int) int {
+	width, n := 0, 0
+	for _, r := range line {
+		if n == col-1 {
+			break
+		}
+		width += runeWidth(r)
+		n++
+	}
+	return width + max(0, col-1-n) + 1
+}
+
+// displayWidth returns how many columns s takes on screen
+func displayWidth(s string) int {
+	return displayCol(s, utf8.RuneCountInString(s)+1) - 1
+}
+
+// runeWidth returns how many columns r takes on screen: none for combining
+// marks and other zero-width characters, two for wide East Asian characters
+// and emoji, and one for the rest
+func runeWidth(r rune) int {
+	switch {
+	case r == '\t':
+		return tabWidth
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case r >= 0x1100 && r <= 0x115F, // Hangul Jamo
+		r >= 0x2E80 && r <= 0xA4CF && r != 0x303F, // CJK, Kana, Yi
+		r >= 0xAC00 && r <= 0xD7A3,                // Hangul syllables
+		r >= 0xF900 && r <= 0xFAFF,                // CJK compatibility ideographs
+		r >= 0xFE30 && r <= 0xFE4F,                // CJK compatibility forms
+		r >= 0xFF00 && r <= 0xFF60,                // fullwidth forms
+		r >= 0xFFE0 && r <= 0xFFE6,
+		r >= 0x1F300 && r <= 0x1F64F, // emoji
+		r >= 0x1F900 && r <= 0x1F9FF,
+		r >= 0x20000 && r <= 0x3FFFD: // CJK extensions
+		return 2
+	}
+	return 1
+}
+
+// TextRenderer writes diagnostics for people to read, in the style of rustc:
+//
+//	error[AY0013]: Expected '}' to close block
+//	 --> main.ay:4:1
+//	  |
+//	1 | f greet(name) {
+//	  |               - opening '{' is here
+//	2 |     print(name)
+//	  |                ^ expected '}'
+//	help: add '}'
+//	  |
+//	3 | }
+//	  | +
+type TextRenderer struct {
+	File string
+	// Line returns the text of a source line, such as Parser.Line. Without
+	// it only the messages are written.
+	Line func(n int) (string, bool)
+	// Color marks up the output with ANSI colors, for terminals
+	Color bool
+}
+
+func (r TextRenderer) Render(w io.Writer, diagnostics []Diagnostic) error {
+	for _, d := range diagnostics {
+		if _, err := io.WriteString(w, r.text(d)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ANSI styles for the parts of a diagnostic
+const (
+	styleError   = "1;31"
+	styleWarning = "1;33"
+	styleGutter  = "1;34"
+	styleBold    = "1"
+	styleHelp    = "1;36"
+	styleAdded   = "32"
+)
+
+// paint wraps s in an ANSI style when colors are on
+func (r TextRenderer) paint(style, s string) string {
+	if !r.Color || s == "" {
+		return s
+	}
+	return "\x1b[" + style + "m" + s + "\x1b[0m"
+}
+
+// annotation is a span to underline under the source, with its label
+type annotation struct {
+	start, end Pos // end is just past the last character, on the same line for all but the main span
+	label      string
+	primary    bool
+}
+
+// lineText returns the text of source line n
+func (r TextRenderer) lineText(n int) (string, bool) {
+	if r.Line == nil {
+		return "", false
+	}
+	return r.Line(n)
+}
+
+// settle moves a position past the end of the source, such as EOF after a
+// final line break, to the end of the last line so it can be shown
+func (r TextRenderer) settle(pos Pos) Pos {
+	if _, ok := r.lineText(pos.Line); !ok && pos.Col == 1 && pos.Line > 1 {
+		if prev, ok := r.lineText(pos.Line - 1); ok {
+			return Pos{Line: pos.Line - 1, Col: utf8.RuneCountInString(prev) + 1, Offset: pos.Offset}
+		}
+	}
+	return pos
+}
+
+// annotate turns a span into an annotation. A span ending at the start of a
+// line ends at the end of the line before, and an empty span still marks one
+// character. Only the main span may run over several lines.
+func (r TextRenderer) annotate(span Span, label string, primary bool) annotation {
+	start, end := r.settle(span.Start), r.settle(span.End)
+	if end.Line > start.Line && end.Col == 1 {
+		if prev, ok := r.lineText(end.Line - 1); ok {
+			end = Pos{Line: end.Line - 1, Col: utf8.RuneCountInString(prev) + 1}
+		}
+	}
+	if end.Line > start.Line && !primary {
+		end = Pos{Line: start.Line, Col: start.Col + 1}
+		if line, ok := r.lineText(start.Line); ok {
+			end.Col = max(end.Col, utf8.RuneCountInString(line)+1)
+		}
+	}
+	if end.Line < start.Line || end.Line == start.Line && end.Col <= start.Col {
+		end = Pos{Line: start.Line, Col: start.Col + 1}
+	}
+	return annotation{start: start, end: end, label: label, primary: primary}
+}
+
+// text renders one diagnostic
+func (r TextRenderer) text(d Diagnostic) string {
+	var b strings.Builder
+	severityStyle := styleError
+	if d.Severity == SeverityWarning {
+		severityStyle = styleWarning
+	}
+	fmt.Fprintf(&b, "%s%s\n", r.paint(severityStyle, fmt.Sprintf("%s[%s]", d.Severity, d.Code)), r.paint(styleBold, ": "+d.Message))
+
+	main := r.annotate(d.Span, d.Label, true)
+	annotations := []annotation{main}
+	for _, related := range d.Related {
+		annotations = append(annotations, r.annotate(related.Span, related.Message, false))
+	}
+	lines := r.shownLines(annotations)
+
+	gutter := strings.Repeat(" ", len(fmt.Sprint(slices.Max(append(lines, main.start.Line)))))
+	bar := r.paint(styleGutter, "|")
+	fmt.Fprintf(&b, "%s%s %s:%d:%d\n", gutter, r.paint(styleGutter, "-->"), r.File, d.Span.Start.Line, d.Span.Start.Col)
+
+	if len(lines) > 0 {
+		multiline := main.end.Line > main.start.Line
+		// Source columns start after a margin that holds the line along the
+		// left of a span running over several lines
+		margin := func(n int) string {
+			switch {
+			case !multiline:
+				return ""
+			case n > main.start.Line && n <= main.end.Line:
+				return r.paint(severityStyle, "|") + " "
+			}
+			return "  "
+		}
+
+		fmt.Fprintf(&b, "%s %s\n", gutter, bar)
+		for i, n := range lines {
+			if i > 0 && n > lines[i-1]+1 {
+				fmt.Fprintf(&b, "%s\n", r.paint(styleGutter, "..."))
+			}
+			text, _ := r.lineText(n)
+			fmt.Fprintf(&b, "%s %s %s%s\n", r.paint(styleGutter, fmt.Sprintf("%*d", len(gutter), n)), bar, margin(n), displayLine(text))
+
+			if multiline && n == main.start.Line {
+				start := displayCol(text, main.start.Col)
+				fmt.Fprintf(&b, "%s %s %s\n", gutter, bar, r.paint(severityStyle, " "+strings.Repeat("_", start)+"^"))
+			}
+			for _, a := range annotations {
+				if a.start.Line != n || a.end.Line != n {
+					continue
+				}
+				mark, style := "-", styleGutter
+				if a.primary {
+					mark, style = "^", severityStyle
+				}
+				start, end := displayCol(text, a.start.Col), displayCol(text, a.end.Col)
+				underline := strings.Repeat(" ", start-1) + r.paint(style, strings.Repeat(mark, max(1, end-start)))
+				fmt.Fprintf(&b, "%s %s %s%s%s\n", gutter, bar, margin(n), underline, r.paint(style, labelText(a.label)))
+			}
+			if multiline && n == main.end.Line {
+				end := displayCol(text, main.end.Col)
+				fmt.Fprintf(&b, "%s %s %s\n", gutter, bar, r.paint(severityStyle, "|"+strings.Repeat("_", max(1, end-1))+"^"+labelText(main.label)))
+			}
+		}
+	}
+
+	for _, note := range d.Notes {
+		fmt.Fprintf(&b, "%s %s %s\n", gutter, r.paint(styleGutter, "="), r.paint(styleBold, "note: ")+note)
+	}
+	if d.Fix != nil {
+		b.WriteString(r.fixText(*d.Fix, gutter))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// labelText returns a label to write after an underline
+func labelText(label string) string {
+	if label == "" {
+		return ""
+	}
+	return " " + label
+}
+
+// shownLines returns the source lines to show for annotations, in order:
+// the lines they cover, with context around them. Long spans show only the
+// lines at each end.
+func (r TextRenderer) shownLines(annotations []annotation) []int {
+	var lines []int
+	for _, a := range annotations {
+		from, to := a.start.Line-contextBefore, a.end.Line+contextAfter
+		for n := from; n <= to; n++ {
+			inside := n > a.start.Line+spanEdgeLines && n < a.end.Line-spanEdgeLines
+			if _, ok := r.lineText(n); ok && !inside && !slices.Contains(lines, n) {
+				lines = append(lines, n)
+			}
+		}
+	}
+	slices.Sort(lines)
+	return lines
+}
+
+// fixText renders a suggested fix, showing the line with the fix made when
+// it is a change to a single line
+func (r TextRenderer) fixText(fix Fix, gutter string) string {
+	line, ok := r.lineText(fix.Span.Start.Line)
+	if !ok && fix.Span.Start.Col == 1 {
+		// A fix just past the last line starts a new one
+		_, ok = r.lineText(fix.Span.Start.Line - 1)
+	}
+	if !ok || fix.Span.End.Line != fix.Span.Start.Line || strings.Contains(fix.Replacement, "\n") {
+		return fmt.Sprintf("%s %s %s%s: `%s`\n", gutter, r.paint(styleGutter, "="), r.paint(styleHelp, "help: "), fix.Message, fix.Replacement)
+	}
+
+	runes := []rune(line)
+	from := min(fix.Span.Start.Col-1, len(runes))
+	to := min(max(fix.Span.End.Col-1, from), len(runes))
+	before := string(runes[:from])
+	fixed := displayLine(before) + r.paint(styleAdded, displayLine(fix.Replacement)) + displayLine(string(runes[to:]))
+	mark := "+"
+	if to > from {
+		mark = "~"
+	}
+	underline := strings.Repeat(" ", displayWidth(before)) + r.paint(styleAdded, strings.Repeat(mark, max(1, displayWidth(fix.Replacement))))
+
+	bar := r.paint(styleGutter, "|")
+	gutter = strings.Repeat(" ", max(len(gutter), len(fmt.Sprint(fix.Span.Start.Line))))
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s%s\n", r.paint(styleHelp, "help: "), fix.Message)
+	fmt.Fprintf(&b, "%s %s\n", gutter, bar)
+	fmt.Fprintf(&b, "%s %s %s\n", r.paint(styleGutter, fmt.Sprintf("%*d", len(gutter), fix.Span.Start.Line)), bar, fixed)
+	fmt.Fprintf(&b, "%s %s %s\n", gutter, bar, underline)
+	return b.String()
+}
+
+// JSONRenderer writes diagnostics as one JSON object, for editors and CI:
+//
+//	{"file": "main.ay", "diagnostics": [{"severity": "error", "code": "AY0013", ...}]}
+type JSONRenderer struct {
+	File string
+}
+
+func (r JSONRenderer) Render(w io.Writer, diagnostics []Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	out, err := json.MarshalIndent(struct {
+		File        string       `json:"file"`
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	}{r.File, diagnostics}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", out)
+	return err
+}
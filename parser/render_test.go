@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/render")
+
+// parseDiagnostics parses src and returns its errors and warnings in source
+// order, as the compiler writes them
+func parseDiagnostics(src string) (*Parser, []Diagnostic) {
+	p := NewParser(src)
+	p.Start()
+	diagnostics := append(p.Errors, p.Warnings...)
+	return p, diagnostics
+}
+
+// checkGolden compares got with the golden file, or rewrites it with -update
+func checkGolden(t *testing.T, golden string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+}
+
+// Each source in testdata/render is rendered as text and as JSON, and
+// compared with the .txt and .json files next to it
+func TestRenderersMatchGolden(t *testing.T) {
+	sources, err := filepath.Glob("testdata/render/*.ay")
+	if err != nil || len(sources) == 0 {
+		t.Fatal("no sources in testdata/render")
+	}
+	for _, source := range sources {
+		t.Run(filepath.Base(source), func(t *testing.T) {
+			src, err := os.ReadFile(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, diagnostics := parseDiagnostics(string(src))
+			file := filepath.Base(source)
+			base := strings.TrimSuffix(source, ".ay")
+
+			var text bytes.Buffer
+			if err := (TextRenderer{File: file, Line: p.Line}).Render(&text, diagnostics); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, base+".txt", text.Bytes())
+
+			var json bytes.Buffer
+			if err := (JSONRenderer{File: file}).Render(&json, diagnostics); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, base+".json", json.Bytes())
+		})
+	}
+}
+
+func TestTextRendererColor(t *testing.T) {
+	_, diagnostics := parseDiagnostics("f greet(name) {\n")
+	var plain, color bytes.Buffer
+	TextRenderer{File: "main.ay"}.Render(&plain, diagnostics)
+	TextRenderer{File: "main.ay", Color: true}.Render(&color, diagnostics)
+	if strings.Contains(plain.String(), "\x1b[") {
+		t.Errorf("output without Color has escape codes:\n%q", plain.String())
+	}
+	if !strings.HasPrefix(color.String(), "\x1b[1;31merror[AY0013]\x1b[0m") {
+		t.Errorf("output with Color doesn't start with a red error header:\n%q", color.String())
+	}
+}
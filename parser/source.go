@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+)
+
+// recentLines is how many source lines are kept for messages when the
+// input can't be read a second time, such as a pipe
+const recentLines = 256
+
+// sourceLines finds the text of source lines for messages without keeping
+// the whole source in memory. It records where each line starts; inputs that
+// can be read again (files, strings) are re-read when a line is needed, and
+// for other inputs the most recent lines are kept.
+type sourceLines struct {
+	src    io.ReaderAt // nil when the input can't be read again
+	base   int64       // offset of the input's start in src
+	starts []int64     // offset of each line, from the start of the input
+	size   int64       // bytes read so far
+	recent []string    // last lines read, by line number modulo recentLines
+}
+
+// newSourceLines returns line tracking for input r
+func newSourceLines(r io.Reader) *sourceLines {
+	s := &sourceLines{}
+	ra, canReadAt := r.(io.ReaderAt)
+	seeker, canSeek := r.(io.Seeker)
+	if canReadAt && canSeek {
+		// Pipes are files too, but they can't seek
+		if base, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			s.src, s.base = ra, base
+			return s
+		}
+	}
+	s.recent = make([]string, recentLines)
+	return s
+}
+
+// add records the next line of the input, with its line break
+func (s *sourceLines) add(line []byte) {
+	s.starts = append(s.starts, s.size)
+	s.size += int64(len(line))
+	if s.src == nil {
+		s.recent[(len(s.starts)-1)%recentLines] = string(trimLineBreak(line))
+	}
+}
+
+// line returns the text of line n (1-based) without its line break. It
+// reports false for lines not read yet, or no longer kept.
+func (s *sourceLines) line(n int) (string, bool) {
+	if n < 1 || n > len(s.starts) {
+		return "", false
+	}
+	if s.src == nil {
+		if n <= len(s.starts)-recentLines {
+			return "", false
+		}
+		return s.recent[(n-1)%recentLines], true
+	}
+
+	end := s.size
+	if n < len(s.starts) {
+		end = s.starts[n]
+	}
+	buf := make([]byte, end-s.starts[n-1])
+	if _, err := s.src.ReadAt(buf, s.base+s.starts[n-1]); err != nil && err != io.EOF {
+		return "", false
+	}
+	return string(trimLineBreak(buf)), true
+}
+
+// offset returns the byte offset of the start of line n (1-based)
+func (s *sourceLines) offset(n int) int {
+	if n < 1 || n > len(s.starts) {
+		return -1
+	}
+	return int(s.starts[n-1])
+}
+
+func trimLineBreak(line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r"))
+}
@@ -1,8 +1,8 @@
 package parser
 
 import (
-	"log"
-	"regexp"
+	"fmt"
+	"io"
 	"slices"
 	"strings"
 )
@@ -44,6 +44,15 @@ var Keywords = []string{
 	"void",
 	"with",
 	"yield",
+	"match",
+	"enum",
+	"record",
+	"await",
+	"assert",
+	"requires",
+	"ensures",
+	"spawn",
+	"select",
 }
 var Tks = map[string]string{
 	"lParen":    "(",
@@ -87,6 +96,9 @@ var Tks = map[string]string{
 	"grTEql":    ">=",
 	"lsTEql":    "<=",
 	"pow":       "^",
+	"hash":      "#",
+	"pipe":      "|>",
+	"arrow":     "=>",
 }
 
 func IsAllowedKeyAsVal(key string) bool {
@@ -110,374 +122,369 @@ const (
 )
 
 type Token struct {
-	Type  int
-	Value string
-	Line  int
-	Col   int
+	Type  int    `json:"type"`
+	Value string `json:"value"`
+	Line  int    `json:"line"`
+	Col   int    `json:"col"` // in runes, from 1
+	// Offset is the byte offset of the token from the start of the source
+	Offset int `json:"offset"`
+	// Raw is the spelling used in the source when it differs from Value,
+	// e.g. a keyword pack word that was translated to its AY keyword
+	Raw string `json:"raw,omitempty"`
+	// End is just past the token's source text. Tokens from a def
+	// expansion all cover the whole use of the def.
+	End Pos `json:"end"`
+
+	// Only kept with Options.Trivia:
+
+	// Leading is the whitespace, comments and other text the parser never
+	// sees (such as code dropped by #if) between the previous token and this one
+	Leading []Token `json:"leading,omitempty"`
+	// Text is the token's exact source text. The first token of a def
+	// expansion holds the text of the whole use; the rest hold none.
+	Text string `json:"text,omitempty"`
+}
+
+// Pos is a place in the source
+type Pos struct {
+	Line   int `json:"line"`
+	Col    int `json:"col"`    // in runes, from 1
+	Offset int `json:"offset"` // in bytes, from 0
+}
+
+// Span is a stretch of source, from Start up to End
+type Span struct {
+	Start Pos `json:"start"`
+	End   Pos `json:"end"`
+}
+
+// Pos returns where the token starts
+func (t Token) Pos() Pos {
+	return Pos{Line: t.Line, Col: t.Col, Offset: t.Offset}
+}
+
+// spanToken returns a token of type typ and value covering span, for
+// messages about nodes
+func spanToken(typ int, value string, span Span) Token {
+	return Token{Type: typ, Value: value, Line: span.Start.Line, Col: span.Start.Col, Offset: span.Start.Offset, End: span.End}
+}
+
+// Spelling returns the token as the user wrote it
+func (t Token) Spelling() string {
+	if t.Raw != "" {
+		return t.Raw
+	}
+	return t.Value
+}
+
+// describe names the token for messages. Line breaks and the end of the
+// source have no spelling worth showing.
+func (t Token) describe() string {
+	switch t.Type {
+	case NewLine:
+		return "end of line"
+	case EOF:
+		return "end of file"
+	}
+	return t.Spelling()
 }
 
 func isKeyword(key string) bool {
 	return slices.Contains(Keywords, key)
 }
-func testRegex(p, s string) bool {
-	re, er := regexp.Compile(p)
-	if er != nil {
-		log.Fatal("Unexpected regex error: ", er)
-	}
-	test := re.MatchString(s)
-
-	return test
-}
-func Tokenize(line string) []Token {
-	var tokens []Token
-	var currentToken string
-	var currentType int
-	var sOpen bool
-	var qChar string
-
-	for i := 0; i < len(line); i++ {
-		char := string(line[i])
-		var nextChar string
-		if i+1 < len(line) {
-			nextChar = string(line[i+1])
+
+// isIdentifier reports whether word lexes as a single identifier
+func isIdentifier(word string) bool {
+	for i, c := range word {
+		if i == 0 && !isIdentStart(c) || !isIdentChar(c) {
+			return false
 		}
+	}
+	return word != ""
+}
 
-		// multi line comment start
-		if i+1 < len(line) && char == "/" && nextChar == "*" && currentType != SingleLineComment && !sOpen {
-			currentType = MultiLineComment
-			currentToken = "/*"
-			continue
+// wordToken classifies a finished identifier-like word as a keyword or an
+// identifier, translating spellings from the active keyword pack
+func wordToken(word string) Token {
+	if isKeyword(word) {
+		return Token{Type: Keyword, Value: word}
+	}
+	if canonical, ok := packKeywords[word]; ok {
+		return Token{Type: Keyword, Value: canonical, Raw: word}
+	}
+	if canonical, ok := packBuiltins[word]; ok {
+		return Token{Type: Identifier, Value: canonical, Raw: word}
+	}
+	return Token{Type: Identifier, Value: word}
+}
 
-		}
-		if i+1 < len(line) && char == "*" && nextChar == "/" && currentType == MultiLineComment && !sOpen {
-			currentToken += "*/"
-			tokens = append(tokens, Token{currentType, currentToken, 0, 0})
-			i++
-			currentToken = ""
-			currentType = Identifier
-			continue
-		}
+// maxPeek is how far ahead of the current token Peek can look. Only this
+// many tokens are read ahead of the parser.
+const maxPeek = 8
 
-		// New lines
-		if i+1 < len(line) && (char == "\r" && nextChar == "\n") && currentType != MultiLineComment {
-			if currentType == SingleLineComment {
-				tokens = append(tokens, Token{currentType, currentToken, 0, 0})
-			}
-			tokens = append(tokens, Token{NewLine, "\r\n", 0, 0})
-			i++
-			currentToken = ""
-			currentType = Identifier
-			continue
-		} else if char == "\n" && currentType != MultiLineComment {
-			if currentType == SingleLineComment {
-				tokens = append(tokens, Token{currentType, currentToken, 0, 0})
-			}
-			tokens = append(tokens, Token{NewLine, "\n", 0, 0})
-			currentToken = ""
-			currentType = Identifier
-			continue
-		}
+// maxBack is how many tokens Back can step back over
+const maxBack = 8
 
-		// this checks if it's a string quote character, controls the value of sOpen
-		// notice how we also make sure we are not in a comment by checking the type
-		if (char == string('"') || char == "'") && currentType != SingleLineComment && currentType != MultiLineComment {
-			qChar = char
-			if sOpen {
-				// extra validation to make sure it's the proper end to the string
-				if len(currentToken) > 0 && string(currentToken[0]) == qChar {
-					currentToken += qChar
-					// Remove quotes from the final token value
-					stringValue := currentToken[1 : len(currentToken)-1] // Remove first and last char (quotes)
-					tokens = append(tokens, Token{currentType, stringValue, 0, 0})
-					// cleanup
-					currentToken = ""
-					sOpen = false
-					currentType = Identifier
-				}
-			} else {
-				currentType = StringLiteral
-				sOpen = true
-				currentToken = char // Start with the opening quote
-			}
-		}
+// TokenGen hands tokens to the parser one at a time. Tokens are read from the
+// source as they are needed, so only a few are held at once.
+type TokenGen struct {
+	CurrentTokenNo int // number of tokens moved past
 
-		// keep adding every character as a comment, but since we only expect a line this is fine as it continues to the end of the line
-		//keep adding string characters until sOpen is false, i.e it's closed with the ending quotechar
-		if sOpen || currentType == SingleLineComment || currentType == MultiLineComment {
-			currentToken += char
-			continue
-		}
+	lexer  *lexer
+	next   func() Token // where tokens come from: the lexer, or a stage over it
+	ahead  []Token      // the current token, then the tokens peeked at
+	behind []Token      // the last tokens moved past, for Back
 
-		identTest := testRegex(`[a-zA-Z_@]`, char)
-		opTest := testRegex(`[+*/%=<>&|!?^-]`, char)
-		litTest := testRegex(`\d`, char)
-		punctTest := testRegex(`[(){}[\]:;,.]`, char)
-
-		if identTest && !sOpen && currentType != SingleLineComment && currentType != MultiLineComment {
-			if currentType == Identifier {
-				currentToken += char
-			} else {
-				currentType = Identifier
-				currentToken = char
-			}
-			//checks if it's the last character or not, passes if not last char
-			if i+1 < len(line) {
-				if !testRegex(`[a-zA-Z_@0-9]`, string(line[i+1])) {
-					if isKeyword(currentToken) {
-						tokens = append(tokens, Token{Keyword, currentToken, 0, 0})
-						currentToken = ""
-					} else {
-						tokens = append(tokens, Token{currentType, currentToken, 0, 0})
-						currentToken = ""
-					}
-				}
-			}
-		} else if testRegex(`\s`, char) && !sOpen && currentType != SingleLineComment && currentType != MultiLineComment {
-			currentType = Whitespace
-			if len(currentToken) > 0 && testRegex(`\s`, currentToken) {
-				currentToken += char
-			} else {
-				currentToken = char
-			}
+	// brackets holds the brackets open at the current token, and
+	// bracketsBehind what it was before each token of behind
+	brackets       *bracket
+	bracketsBehind []*bracket
 
-			if i+1 < len(line) {
-				if !testRegex(`\s`, string(line[i+1])) {
-					tokens = append(tokens, Token{currentType, currentToken, 0, 0})
-					currentToken = ""
-				}
-			}
-		} else if opTest && !sOpen && currentType != SingleLineComment && currentType != MultiLineComment {
-			currentType = Operator
-			if len(currentToken) > 0 && testRegex(`[+*/%=<>&|!?^-]`, currentToken) {
-				switch len(currentToken) {
-				case 1:
-					if currentToken == "/" && char == "/" {
-						// This is a single line comment //
-						currentType = SingleLineComment
-						currentToken += char
-					} else if (currentToken == "=" && char == "=") || (currentToken == "!" && char == "=") ||
-						(currentToken == "<" && char == "=") || (currentToken == ">" && char == "=") ||
-						(currentToken == "&" && char == "&") || (currentToken == "|" && char == "|") ||
-						(currentToken == "+" && char == "+") || (currentToken == "-" && char == "-") ||
-						(currentToken == "+" && char == "=") || (currentToken == "-" && char == "=") ||
-						(currentToken == "*" && char == "=") || (currentToken == "/" && char == "=") ||
-						(currentToken == "%" && char == "=") {
-						currentToken += char
-						tokens = append(tokens, Token{currentType, currentToken, 0, 0})
-						currentToken = ""
-					} else {
-						tokens = append(tokens, Token{currentType, currentToken, 0, 0})
-						currentToken = char
-					}
-				case 2:
-					if (currentToken == ">>" || currentToken == "<<") && (char == ">" || char == "<") {
-						currentToken += char
-						tokens = append(tokens, Token{currentType, currentToken, 0, 0})
-						currentToken = ""
-					} else {
-						// For 2-character operators like <=, >=, ==, !=, etc., push the token and start new one
-						tokens = append(tokens, Token{currentType, currentToken, 0, 0})
-						currentToken = char
-					}
-				default:
-					tokens = append(tokens, Token{Unknown, currentToken, 0, 0})
-					currentToken = char
-				}
-			} else {
-				currentToken = char
-			}
+	recording int     // open startRecording calls
+	recorded  []Token // tokens moved past while recording
+}
 
-			if i+1 < len(line) && currentType != SingleLineComment && currentType != MultiLineComment {
-				if !testRegex(`[+*/%=<>&|!?^-]`, string(line[i+1])) {
-					if currentToken != "" {
-						tokens = append(tokens, Token{currentType, currentToken, 0, 0})
-					}
-					currentToken = ""
-				}
-			}
-		} else if litTest && !sOpen && currentType != SingleLineComment && currentType != MultiLineComment {
-			// If we're already building an identifier, add the digit to it
-			if currentType == Identifier {
-				currentToken += char
-				// check if next char would end the identifier
-				if i+1 < len(line) {
-					if !testRegex(`[a-zA-Z_@0-9]`, nextChar) {
-						tokens = append(tokens, Token{Identifier, currentToken, 0, 0})
-						currentToken = ""
-					}
-				}
-			} else {
-				currentType = Literal
-				if len(currentToken) > 0 && (testRegex(`\d`, currentToken) || strings.HasSuffix(currentToken, ".")) {
-					if testRegex(`\d`, currentToken) || strings.HasSuffix(currentToken, ".") {
-						currentToken += char
-					}
-				} else {
-					currentToken = char
-				}
-				if i+1 < len(line) {
-					if !testRegex(`\d`, nextChar) && nextChar != "." {
-						tokens = append(tokens, Token{currentType, currentToken, 0, 0})
-						currentToken = ""
-					}
-				}
-			}
-		} else if punctTest && !sOpen && currentType != SingleLineComment && currentType != MultiLineComment {
-			if currentType == Literal && char == "." && !strings.Contains(currentToken, ".") && len(currentToken) > 0 {
-				currentToken += char
-			} else {
-				currentType = Punctuation
-				currentToken = char
-				tokens = append(tokens, Token{currentType, currentToken, 0, 0})
-				currentToken = ""
-			}
-		}
-	}
+// NewTokenGen creates a new TokenGen over source text
+func NewTokenGen(file string) *TokenGen {
+	return NewTokenGenReader(strings.NewReader(file))
+}
 
-	// Handle any remaining token at the end
-	if currentToken != "" {
-		if currentType == Identifier && isKeyword(currentToken) {
-			currentType = Keyword
-		}
-		tokens = append(tokens, Token{currentType, currentToken, 0, 0})
+// NewTokenGenReader creates a new TokenGen that reads source from r as
+// tokens are needed
+func NewTokenGenReader(r io.Reader) *TokenGen {
+	l := newLexer(r)
+	return &TokenGen{lexer: l, next: l.next}
+}
+
+// fill reads ahead until n tokens from the current one are available
+func (t *TokenGen) fill(n int) {
+	for len(t.ahead) < n {
+		t.ahead = append(t.ahead, t.next())
 	}
+}
 
-	// Add EOF token
-	tokens = append(tokens, Token{EOF, "", 0, 0})
-	lineNo, colNo := 1, 1
-	strSplit := regexp.MustCompile(`\r\n|\n`)
-	for i, token := range tokens {
-		tokens[i].Line = lineNo
-		tokens[i].Col = colNo
-
-		// Handle multi-line comments and strings that contain newlines
-		if strings.Contains(token.Value, "\n") || strings.Contains(token.Value, "\r\n") {
-			lines := strSplit.Split(token.Value, -1)
-
-			lineNo += len(lines) - 1
-			if len(lines) > 1 {
-				colNo = len(lines[len(lines)-1]) + 1
-			} else {
-				colNo += len(lines[0])
+func (t *TokenGen) Next() {
+	t.fill(1)
+	if t.ahead[0].Type == EOF {
+		return
+	}
+	if t.recording > 0 {
+		t.recorded = append(t.recorded, t.ahead[0])
+	}
+	t.behind = append(t.behind, t.ahead[0])
+	t.bracketsBehind = append(t.bracketsBehind, t.brackets)
+	if len(t.behind) > maxBack {
+		t.behind = slices.Delete(t.behind, 0, 1)
+		t.bracketsBehind = slices.Delete(t.bracketsBehind, 0, 1)
+	}
+	if tk := t.ahead[0]; tk.Type == Punctuation {
+		switch tk.Value {
+		case "(", "[", "{":
+			t.brackets = &bracket{open: tk, depth: t.depth() + 1, outer: t.brackets}
+		case ")", "]", "}":
+			if i := t.opener(tk); i >= 0 {
+				t.closeBrackets(i)
 			}
-		} else if token.Type == NewLine {
-			lineNo++
-			colNo = 1
-		} else {
-			colNo += len(token.Value)
 		}
 	}
-	// Filter out whitespace and comment tokens
-	var filteredTokens []Token
-	for _, token := range tokens {
-		if token.Type != Whitespace && token.Type != SingleLineComment && token.Type != MultiLineComment {
-			filteredTokens = append(filteredTokens, token)
-		}
+	t.ahead = slices.Delete(t.ahead, 0, 1)
+	t.CurrentTokenNo++
+}
+
+// bracket is an open bracket, in a list from the innermost one out. Lists
+// are never changed, so one saved for Back stays as it was.
+type bracket struct {
+	open  Token
+	depth int // brackets open, counting this one
+	outer *bracket
+}
+
+// openerOf returns the bracket that closer closes
+func openerOf(closer string) string {
+	switch closer {
+	case ")":
+		return "("
+	case "]":
+		return "["
+	case "}":
+		return "{"
 	}
+	return ""
+}
 
-	return filteredTokens
+// opener returns how many brackets are open outside the one closed by tk,
+// or -1 if tk closes nothing open. Closing an outer bracket also closes any
+// left open inside it.
+func (t *TokenGen) opener(tk Token) int {
+	if tk.Type != Punctuation {
+		return -1
+	}
+	if b := t.openBracket(tk.Value); b != nil {
+		return b.depth - 1
+	}
+	return -1
 }
 
-type TokenGen struct {
-	Lines          []string
-	CurrentLine    int
-	CurrentTokenNo int
-	Tokens         []Token
+// openBracket returns the innermost open bracket that closer would close, or
+// nil if there is none
+func (t *TokenGen) openBracket(closer string) *bracket {
+	open := openerOf(closer)
+	for b := t.brackets; b != nil && open != ""; b = b.outer {
+		if b.open.Value == open {
+			return b
+		}
+	}
+	return nil
 }
 
-// NewTokenGen creates a new TokenGen instance and tokenizes the input file into lines and tokens.
-func NewTokenGen(file string) *TokenGen {
-	var lines []string
-	if strings.Contains(file, "\r\n") {
-		lines = strings.Split(file, "\r\n")
-	} else {
-		lines = strings.Split(file, "\n")
+// closeBrackets forgets all but the outermost depth open brackets, for
+// recovering from brackets a mistake left open
+func (t *TokenGen) closeBrackets(depth int) {
+	for t.brackets != nil && t.brackets.depth > depth {
+		t.brackets = t.brackets.outer
 	}
-	return &TokenGen{Lines: lines, CurrentLine: 0, CurrentTokenNo: 0, Tokens: Tokenize(file)}
 }
-func (t *TokenGen) Next() {
-	if t.CurrentTokenNo < len(t.Tokens)-1 && t.Tokens[t.CurrentTokenNo].Type != EOF {
-		t.CurrentTokenNo++
+
+// depth returns how many brackets are open at the current token
+func (t *TokenGen) depth() int {
+	if t.brackets == nil {
+		return 0
 	}
+	return t.brackets.depth
 }
+
+// Back steps back to the token before the current one. At the first token
+// it does nothing. Only maxBack tokens are kept, so stepping back further
+// panics like Peek.
 func (t *TokenGen) Back() {
-	if t.CurrentTokenNo != 0 {
-		t.CurrentTokenNo--
+	if len(t.behind) == 0 {
+		if t.CurrentTokenNo > 0 {
+			panic(fmt.Sprintf("TokenGen.Back: only %d tokens are kept", maxBack))
+		}
+		return
 	}
+	last := t.behind[len(t.behind)-1]
+	t.behind = t.behind[:len(t.behind)-1]
+	t.brackets = t.bracketsBehind[len(t.bracketsBehind)-1]
+	t.bracketsBehind = t.bracketsBehind[:len(t.bracketsBehind)-1]
+	t.ahead = slices.Insert(t.ahead, 0, last)
+	if t.recording > 0 && len(t.recorded) > 0 {
+		t.recorded = t.recorded[:len(t.recorded)-1]
+	}
+	t.CurrentTokenNo--
 }
 
+// Peek returns the token steps+1 ahead of the current one, so Peek(0) is the
+// next token. Only maxPeek tokens are read ahead; looking further is a
+// mistake in the parser, so it panics rather than give the wrong token.
 func (t *TokenGen) Peek(steps int) Token {
-	if steps != 0 && (steps+1+t.CurrentTokenNo) < len(t.Tokens) {
-		return t.Tokens[t.CurrentTokenNo+steps+1]
-	} else {
-		return t.Tokens[t.CurrentTokenNo+1]
+	if steps < 0 || steps >= maxPeek {
+		panic(fmt.Sprintf("TokenGen.Peek(%d): only %d tokens are read ahead", steps, maxPeek))
 	}
+	t.fill(steps + 2)
+	return t.ahead[steps+1]
 }
 
 func (t *TokenGen) Skip(steps int) Token {
-	if steps != 0 && (steps+t.CurrentTokenNo) < len(t.Tokens) {
-		t.CurrentTokenNo += steps
-	} else {
-		t.CurrentTokenNo++ // move forward once
+	if steps == 0 {
+		steps = 1 // move forward once
+	}
+	for i := 0; i < steps; i++ {
+		t.Next()
 	}
 	return t.GetCurrentToken()
 }
 
 // Get current token
 func (t *TokenGen) GetCurrentToken() Token {
-	if t.CurrentTokenNo >= len(t.Tokens) {
-		return Token{Type: EOF, Value: "", Line: 0, Col: 0}
-	}
-	return t.Tokens[t.CurrentTokenNo]
+	t.fill(1)
+	return t.ahead[0]
 }
 
 // GetCurrentLineNumber returns the current line number (line is already1-based index)
 func (t *TokenGen) GetCurrentLineNumber() int {
-	return t.Tokens[t.CurrentTokenNo].Line
+	return t.GetCurrentToken().Line
 }
 
 // GetCurrentColNumber returns the current column number (1-based index)
 func (t *TokenGen) GetCurrentColNumber() int {
-	return t.Tokens[t.CurrentTokenNo].Col + 1
+	return t.GetCurrentToken().Col
 }
 
-// GetRemainingToken returns all tokens from the current position to the end
+// GetRemainingToken returns all tokens from the current position to the end.
+// It reads the rest of the source.
 func (t *TokenGen) GetRemainingToken() []Token {
-	return t.Tokens[t.CurrentTokenNo+1:]
+	t.fill(1)
+	for t.ahead[len(t.ahead)-1].Type != EOF {
+		t.ahead = append(t.ahead, t.next())
+	}
+	return slices.Clone(t.ahead[1:])
 }
 
 // GetTokenLeftLine returns all tokens left in the current line from the current position
 func (t *TokenGen) GetTokenLeftLine() []Token {
-	tokenLeft := t.GetRemainingToken()
 	leftLineTokens := []Token{}
-	for _, v := range tokenLeft {
-		if v.Type == NewLine {
-			leftLineTokens = append(leftLineTokens, v)
-			break
-		}
+	for i := 1; ; i++ {
+		t.fill(i + 1)
+		v := t.ahead[i]
 		leftLineTokens = append(leftLineTokens, v)
+		if v.Type == NewLine || v.Type == EOF {
+			return leftLineTokens
+		}
 	}
-	return leftLineTokens
 }
 
-// GetFullLineToken returns all tokens in the current line
-func (t *TokenGen) GetFullLineToken() []Token {
-	flToken := []Token{}
-	for _, v := range t.Tokens {
-		if v.Type == NewLine {
-			break
-		}
-		flToken = append(flToken, v)
+func (t *TokenGen) ToNewLine() {
+	for !t.atLineEnd() {
+		t.Next()
+	}
+	if t.GetCurrentToken().Type == NewLine {
+		t.Next()
 	}
-	slices.Reverse(flToken)
-	return flToken
 }
 
-func (t *TokenGen) ToNewLine() {
-	for t.Tokens[t.CurrentTokenNo].Type != NewLine && t.Tokens[t.CurrentTokenNo].Type != EOF {
-		t.CurrentTokenNo++
+func (t *TokenGen) atLineEnd() bool {
+	tk := t.GetCurrentToken()
+	return tk.Type == NewLine || tk.Type == EOF
+}
+
+// Line returns the text of source line n (1-based). Lines of piped input are
+// only kept for a while, so old ones may no longer be available.
+func (t *TokenGen) Line(n int) (string, bool) {
+	return t.lexer.lines.line(n)
+}
+
+// prev returns the last token moved past
+func (t *TokenGen) prev() Token {
+	if len(t.behind) == 0 {
+		return Token{}
 	}
-	if t.Tokens[t.CurrentTokenNo].Type == NewLine {
-		t.CurrentTokenNo++
+	return t.behind[len(t.behind)-1]
+}
+
+// lineOffset returns the byte offset of the start of source line n, or -1
+// if line n hasn't been read
+func (t *TokenGen) lineOffset(n int) int {
+	return t.lexer.lines.offset(n)
+}
+
+// Err returns the error that stopped reading the source early, if any
+func (t *TokenGen) Err() error {
+	return t.lexer.err
+}
+
+// startRecording starts keeping the tokens moved past. The tokens since the
+// returned mark are handed back by stopRecording.
+func (t *TokenGen) startRecording() int {
+	t.recording++
+	return len(t.recorded)
+}
+
+func (t *TokenGen) stopRecording(mark int) []Token {
+	tokens := slices.Clone(t.recorded[mark:])
+	t.recording--
+	if t.recording == 0 {
+		t.recorded = t.recorded[:0]
 	}
+	return tokens
 }
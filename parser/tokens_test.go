@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// mustPanic fails the test unless f panics
+func mustPanic(t *testing.T, name string, f func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s did not panic", name)
+		}
+	}()
+	f()
+}
+
+// letters returns source of single-letter names a, b, c, ... n of them
+func letters(n int) string {
+	var names []string
+	for i := range n {
+		names = append(names, string(rune('a'+i)))
+	}
+	return strings.Join(names, " ")
+}
+
+func TestPeekLimit(t *testing.T) {
+	tg := NewTokenGen(letters(maxPeek + 4))
+	for steps := range maxPeek {
+		if got, want := tg.Peek(steps).Value, string(rune('a'+steps+1)); got != want {
+			t.Errorf("Peek(%d) = %q, want %q", steps, got, want)
+		}
+	}
+	mustPanic(t, "Peek(maxPeek)", func() { tg.Peek(maxPeek) })
+	mustPanic(t, "Peek(-1)", func() { tg.Peek(-1) })
+
+	// Peeking past the end of the source gives EOF, within the limit
+	tg = NewTokenGen("a")
+	if got := tg.Peek(maxPeek - 1); got.Type != EOF {
+		t.Errorf("Peek past the end = %q, want EOF", got.Value)
+	}
+}
+
+func TestBackLimit(t *testing.T) {
+	tg := NewTokenGen(letters(maxBack + 4))
+	tg.Back() // at the first token there is nothing to step back to
+	if got := tg.GetCurrentToken().Value; got != "a" {
+		t.Fatalf("Back at the first token moved to %q", got)
+	}
+
+	for range maxBack + 1 {
+		tg.Next()
+	}
+	for i := range maxBack {
+		tg.Back()
+		if got, want := tg.GetCurrentToken().Value, string(rune('a'+maxBack-i)); got != want {
+			t.Errorf("after %d Back calls the token is %q, want %q", i+1, got, want)
+		}
+	}
+	mustPanic(t, "Back past maxBack", tg.Back)
+}
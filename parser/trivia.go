@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+)
+
+// Program returns the parsed file as a single Program node over Nodes. With
+// Options.Trivia it also holds the tokens outside every statement, such as
+// blank lines and the EOF token carrying any trailing comments.
+func (p *Parser) Program() ASTNode {
+	end := p.tokenizer.GetCurrentToken().End
+	return ASTNode{Type: Program, Body: p.Nodes, Span: Span{Start: Pos{Line: 1, Col: 1}, End: end}, Tokens: p.loose}
+}
+
+// attachTokens hands each of tokens, in source order, to the innermost node
+// under n whose span holds it. Tokens outside every child stay with n.
+func attachTokens(n *ASTNode, tokens []Token) {
+	kids := n.children()
+	slices.SortStableFunc(kids, func(a, b *ASTNode) int {
+		return cmp.Compare(a.Span.Start.Offset, b.Span.Start.Offset)
+	})
+	// reach[i] is the furthest any of kids[:i+1] ends, so the search for a
+	// token's owner can stop once no earlier kid reaches it
+	reach := make([]int, len(kids))
+	for i, kid := range kids {
+		reach[i] = kid.Span.End.Offset
+		if i > 0 {
+			reach[i] = max(reach[i], reach[i-1])
+		}
+	}
+
+	owned := make([][]Token, len(kids))
+	for _, tk := range tokens {
+		owner := -1
+		i := sort.Search(len(kids), func(i int) bool { return kids[i].Span.Start.Offset > tk.Offset }) - 1
+		for ; i >= 0 && reach[i] > tk.Offset; i-- {
+			if kids[i].Span.End.Offset > tk.Offset {
+				owner = i
+				break
+			}
+		}
+		if owner < 0 {
+			n.Tokens = append(n.Tokens, tk)
+		} else {
+			owned[owner] = append(owned[owner], tk)
+		}
+	}
+	for i, kid := range kids {
+		attachTokens(kid, owned[i])
+	}
+}
+
+// subtreeTokens returns the tokens of node and every node under it, in
+// source order
+func subtreeTokens(node *ASTNode) []Token {
+	var tokens []Token
+	var collect func(n *ASTNode)
+	collect = func(n *ASTNode) {
+		tokens = append(tokens, n.Tokens...)
+		for _, child := range n.children() {
+			collect(child)
+		}
+	}
+	collect(node)
+	// Tokens of one def expansion share an offset, but only the first has text
+	slices.SortStableFunc(tokens, func(a, b Token) int { return cmp.Compare(a.Offset, b.Offset) })
+	return tokens
+}
+
+// Reconstruct rebuilds the source text of node, including the whitespace and
+// comments before each of its tokens, from a tree parsed with Options.Trivia.
+// For the Program node that is the source exactly as it was read.
+func Reconstruct(node ASTNode) string {
+	return tokenSource(subtreeTokens(&node))
+}
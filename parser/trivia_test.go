@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// reconstruct parses src keeping trivia and rebuilds it from the tree
+func reconstruct(src string) string {
+	p := NewParserWithOptions(src, Options{Trivia: true})
+	p.Start()
+	return Reconstruct(p.Program())
+}
+
+// Every source in testdata, including ones with errors, is rebuilt byte for
+// byte from its tree
+func TestReconstructRoundTrip(t *testing.T) {
+	sources, err := filepath.Glob("testdata/*/*.ay")
+	if err != nil || len(sources) == 0 {
+		t.Fatal("no sources in testdata")
+	}
+	for _, source := range sources {
+		src, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := reconstruct(string(src)); got != string(src) {
+			i := 0
+			for i < len(got) && i < len(src) && got[i] == src[i] {
+				i++
+			}
+			t.Errorf("%s: rebuilt source differs from byte %d: got %q, want %q",
+				source, i, got[i:min(len(got), i+30)], src[i:min(len(src), i+30)])
+		}
+	}
+}
+
+func FuzzReconstruct(f *testing.F) {
+	sources, _ := filepath.Glob("testdata/*/*.ay")
+	for _, source := range sources {
+		src, err := os.ReadFile(source)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(src))
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		if got := reconstruct(src); got != src {
+			t.Errorf("rebuilt %q as %q", src, got)
+		}
+	})
+}